@@ -0,0 +1,276 @@
+package contempt
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Finding describes a material that is affected by a known vulnerability.
+type Finding struct {
+	Material string `json:"material"`
+	Version  string `json:"version"`
+	Advisory string `json:"advisory"`
+	Summary  string `json:"summary,omitempty"`
+	// Fixed is the first version that is not affected, if known.
+	Fixed string `json:"fixed,omitempty"`
+}
+
+// AdvisoryDatabase contains vulnerability advisories in OSV format, indexed by the material they affect.
+type AdvisoryDatabase struct {
+	advisories map[string][]osvAdvisory
+}
+
+type osvAdvisory struct {
+	ID       string        `json:"id"`
+	Summary  string        `json:"summary"`
+	Affected []osvAffected `json:"affected"`
+}
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []struct {
+		Type   string     `json:"type"`
+		Events []osvEvent `json:"events"`
+	} `json:"ranges"`
+	Versions []string `json:"versions"`
+}
+
+type osvEvent struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// LoadAdvisories loads OSV advisories from the given path, which may be a directory containing JSON files (which is
+// searched recursively), a single JSON file, or a zip file such as those exported by osv.dev.
+func LoadAdvisories(path string) (*AdvisoryDatabase, error) {
+	db := &AdvisoryDatabase{advisories: make(map[string][]osvAdvisory)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		err = db.loadFS(os.DirFS(path))
+	} else if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		var r *zip.ReadCloser
+		r, err = zip.OpenReader(path)
+		if err == nil {
+			defer r.Close()
+			err = db.loadFS(r)
+		}
+	} else {
+		var f *os.File
+		f, err = os.Open(path)
+		if err == nil {
+			defer f.Close()
+			err = db.load(path, f)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadFS loads all JSON files within the given filesystem.
+func (db *AdvisoryDatabase) loadFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(strings.ToLower(path), ".json") {
+			return nil
+		}
+
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return db.load(path, f)
+	})
+}
+
+// load reads a single OSV advisory and indexes it by the materials it affects.
+func (db *AdvisoryDatabase) load(name string, reader io.Reader) error {
+	var advisory osvAdvisory
+	if err := json.NewDecoder(reader).Decode(&advisory); err != nil {
+		return fmt.Errorf("invalid advisory %s: %v", name, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range advisory.Affected {
+		for _, material := range osvMaterials(advisory.Affected[i].Ecosystem(), advisory.Affected[i].Package.Name) {
+			if !seen[material] {
+				seen[material] = true
+				db.advisories[material] = append(db.advisories[material], advisory)
+			}
+		}
+	}
+	return nil
+}
+
+// Ecosystem returns the name of the ecosystem the affected package is in, without any release qualifier (e.g.
+// "Alpine:v3.20" becomes "Alpine").
+func (a osvAffected) Ecosystem() string {
+	ecosystem, _, _ := strings.Cut(a.Package.Ecosystem, ":")
+	return ecosystem
+}
+
+// goMajorVersionSuffix matches the major version suffix of a Go module path, e.g. the "/v2" in "example.com/foo/v2".
+var goMajorVersionSuffix = regexp.MustCompile(`/v[0-9]+$`)
+
+// osvMaterials returns the names of the materials that may correspond to a package in an OSV ecosystem, or nil if the
+// ecosystem isn't supported.
+//
+// Go modules are matched to the git repository they're hosted in, ignoring any major version suffix: modules on
+// GitHub may be used as either github or git materials, and those hosted elsewhere as git materials.
+func osvMaterials(ecosystem, name string) []string {
+	switch ecosystem {
+	case "Alpine":
+		return []string{fmt.Sprintf("apk:%s", name)}
+	case "Go":
+		repo := goMajorVersionSuffix.ReplaceAllString(name, "")
+		if !strings.Contains(repo, ".") || !strings.Contains(repo, "/") {
+			// Standard library packages and the like aren't hosted anywhere.
+			return nil
+		}
+
+		res := []string{fmt.Sprintf("git:https://%s", repo), fmt.Sprintf("git:https://%s.git", repo)}
+		if strings.HasPrefix(repo, "github.com/") {
+			res = append([]string{fmt.Sprintf("github:%s", strings.TrimPrefix(repo, "github.com/"))}, res...)
+		}
+		return res
+	}
+	return nil
+}
+
+// Audit returns all the findings for the given materials, sorted by material and advisory.
+func (db *AdvisoryDatabase) Audit(materials map[string]Material) []Finding {
+	var res []Finding
+	for name := range materials {
+		m := materials[name]
+		for _, advisory := range db.advisories[name] {
+			for _, affected := range advisory.Affected {
+				if !slices.Contains(osvMaterials(affected.Ecosystem(), affected.Package.Name), name) {
+					continue
+				}
+
+				if isAffected, fixed := affected.affects(m.Type, m.Version); isAffected {
+					res = append(res, Finding{
+						Material: name,
+						Version:  m.Version,
+						Advisory: advisory.ID,
+						Summary:  advisory.Summary,
+						Fixed:    fixed,
+					})
+					break
+				}
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Material == res[j].Material {
+			return res[i].Advisory < res[j].Advisory
+		}
+		return res[i].Material < res[j].Material
+	})
+	return res
+}
+
+// AuditProject reads the bill of materials from the given output file and audits it against the database.
+func (db *AdvisoryDatabase) AuditProject(outFile string) ([]Finding, error) {
+	materials, err := loadBillOfMaterials(outFile)
+	if err != nil {
+		return nil, err
+	}
+	return db.Audit(materials), nil
+}
+
+// affects determines whether the given version of a material is affected, returning the version that fixes it if one
+// is known. Explicitly listed versions are checked first (ignoring any "v" or "go" prefix, as OSV versions don't
+// include them), followed by any ECOSYSTEM or SEMVER ranges.
+func (a osvAffected) affects(kind, version string) (bool, string) {
+	for i := range a.Versions {
+		if trimVersionPrefix(a.Versions[i]) == trimVersionPrefix(version) {
+			return true, ""
+		}
+	}
+
+	compare := func(x, y string) int {
+		if x == y {
+			return 0
+		} else if x == "0" {
+			return -1
+		} else if y == "0" {
+			return 1
+		}
+		cmp, _, _ := compareVersions(kind, x, y)
+		return cmp
+	}
+
+	for _, r := range a.Ranges {
+		if r.Type != "ECOSYSTEM" && r.Type != "SEMVER" {
+			continue
+		}
+
+		// Each "introduced" event starts an affected interval, which is ended by the next fixed, last_affected or
+		// limit event (if any).
+		events := append([]osvEvent{}, r.Events...)
+		sort.SliceStable(events, func(i, j int) bool {
+			return compare(events[i].version(), events[j].version()) < 0
+		})
+
+		start := ""
+		for _, e := range events {
+			switch {
+			case e.Introduced != "":
+				if start == "" {
+					start = e.Introduced
+				}
+			case start == "":
+				continue
+			case e.Fixed != "" || e.Limit != "":
+				end := e.Fixed + e.Limit
+				if compare(version, start) >= 0 && compare(version, end) < 0 {
+					return true, e.Fixed
+				}
+				start = ""
+			case e.LastAffected != "":
+				if compare(version, start) >= 0 && compare(version, e.LastAffected) <= 0 {
+					return true, ""
+				}
+				start = ""
+			}
+		}
+
+		if start != "" && compare(version, start) >= 0 {
+			return true, ""
+		}
+	}
+
+	return false, ""
+}
+
+// version returns whichever version the event refers to.
+func (e osvEvent) version() string {
+	return e.Introduced + e.Fixed + e.LastAffected + e.Limit
+}
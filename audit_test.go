@@ -0,0 +1,165 @@
+package contempt
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdvisory = `{
+  "id": "ALPINE-CVE-2024-0001",
+  "summary": "Buffer overflow in musl",
+  "affected": [{
+    "package": {"ecosystem": "Alpine:v3.19", "name": "musl"},
+    "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.2.4-r3"}]}]
+  }]
+}`
+
+const testGoAdvisory = `{
+  "id": "GO-2024-0002",
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "github.com/example/tool"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.1.0"}, {"last_affected": "1.2.0"}, {"introduced": "2.0.0"}]}]
+  }]
+}`
+
+const testGoVersionsAdvisory = `{
+  "id": "GO-2024-0003",
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "github.com/example/lib/v2"},
+    "versions": ["2.0.0", "2.0.1"]
+  }, {
+    "package": {"ecosystem": "Go", "name": "git.example.com/tools/cli"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.0.0"}]}]
+  }]
+}`
+
+func writeAdvisories(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ALPINE-CVE-2024-0001.json"), []byte(testAdvisory), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "go"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go", "GO-2024-0002.json"), []byte(testGoAdvisory), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go", "GO-2024-0003.json"), []byte(testGoVersionsAdvisory), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not an advisory"), 0600))
+	return dir
+}
+
+func TestAdvisoryDatabase_Audit(t *testing.T) {
+	db, err := LoadAdvisories(writeAdvisories(t))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		materials map[string]Material
+		want      []Finding
+	}{
+		{
+			"Reports apk packages before the fixed version",
+			map[string]Material{"apk:musl": {Type: "apk", Version: "1.2.4-r2"}},
+			[]Finding{{Material: "apk:musl", Version: "1.2.4-r2", Advisory: "ALPINE-CVE-2024-0001", Summary: "Buffer overflow in musl", Fixed: "1.2.4-r3"}},
+		},
+		{
+			"Ignores apk packages at the fixed version",
+			map[string]Material{"apk:musl": {Type: "apk", Version: "1.2.4-r3"}},
+			nil,
+		},
+		{
+			"Ignores unrelated materials",
+			map[string]Material{"apk:busybox": {Type: "apk", Version: "1.0.0-r0"}, "image:musl": {Type: "image", Version: "abc"}},
+			nil,
+		},
+		{
+			"Reports github materials up to the last affected version",
+			map[string]Material{"github:example/tool": {Type: "github", Version: "v1.2.0"}},
+			[]Finding{{Material: "github:example/tool", Version: "v1.2.0", Advisory: "GO-2024-0002"}},
+		},
+		{
+			"Ignores github materials between affected ranges",
+			map[string]Material{"github:example/tool": {Type: "github", Version: "v1.3.0"}},
+			nil,
+		},
+		{
+			"Reports github materials in an unbounded range",
+			map[string]Material{"github:example/tool": {Type: "github", Version: "v2.1.0"}},
+			[]Finding{{Material: "github:example/tool", Version: "v2.1.0", Advisory: "GO-2024-0002"}},
+		},
+		{
+			"Reports explicitly listed versions of major version modules with a v prefix",
+			map[string]Material{"github:example/lib": {Type: "github", Version: "v2.0.1"}},
+			[]Finding{{Material: "github:example/lib", Version: "v2.0.1", Advisory: "GO-2024-0003"}},
+		},
+		{
+			"Ignores versions that aren't listed",
+			map[string]Material{"github:example/lib": {Type: "github", Version: "v2.0.2"}},
+			nil,
+		},
+		{
+			"Reports git materials for modules hosted outside GitHub",
+			map[string]Material{"git:https://git.example.com/tools/cli.git": {Type: "git", Version: "v0.9.0"}},
+			[]Finding{{Material: "git:https://git.example.com/tools/cli.git", Version: "v0.9.0", Advisory: "GO-2024-0003", Fixed: "1.0.0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, db.Audit(tt.materials))
+		})
+	}
+}
+
+func TestLoadAdvisories_zip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "all.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	w := zip.NewWriter(f)
+	entry, err := w.Create("ALPINE-CVE-2024-0001.json")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte(testAdvisory))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	db, err := LoadAdvisories(path)
+	require.NoError(t, err)
+	assert.Len(t, db.Audit(map[string]Material{"apk:musl": {Type: "apk", Version: "1.2.3-r0"}}), 1)
+}
+
+func TestAdvisoryDatabase_AuditProject(t *testing.T) {
+	db, err := LoadAdvisories(writeAdvisories(t))
+	require.NoError(t, err)
+
+	out := filepath.Join(t.TempDir(), "Dockerfile")
+	require.NoError(t, os.WriteFile(out, []byte("# Generated from x\n# BOM: {\"apk:musl\":\"1.2.4-r0\"}\n\nFROM scratch\n"), 0600))
+
+	findings, err := db.AuditProject(out)
+	require.NoError(t, err)
+	assert.Len(t, findings, 1)
+
+	require.NoError(t, os.WriteFile(out, []byte("FROM scratch\n"), 0600))
+	_, err = db.AuditProject(out)
+	assert.Error(t, err)
+}
+
+func Test_osvMaterials(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		name      string
+		want      []string
+	}{
+		{"Alpine", "musl", []string{"apk:musl"}},
+		{"Go", "github.com/example/tool", []string{"github:example/tool", "git:https://github.com/example/tool", "git:https://github.com/example/tool.git"}},
+		{"Go", "github.com/example/lib/v12", []string{"github:example/lib", "git:https://github.com/example/lib", "git:https://github.com/example/lib.git"}},
+		{"Go", "git.example.com/tools/cli/v2", []string{"git:https://git.example.com/tools/cli", "git:https://git.example.com/tools/cli.git"}},
+		{"Go", "stdlib", nil},
+		{"PyPI", "requests", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ecosystem+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, osvMaterials(tt.ecosystem, tt.name))
+		})
+	}
+}
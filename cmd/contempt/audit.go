@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/csmith/contempt"
+)
+
+var (
+	advisories      = flag.String("advisories", "", "Path to a directory, JSON file or zip file of OSV advisories to audit projects against")
+	auditRegenerate = flag.Bool("audit-regenerate", false, "Whether to regenerate and rebuild projects affected by advisories when auditing")
+)
+
+// runAudit checks the BOM of each project against the advisory database, and optionally regenerates any that are
+// affected. Exits with an error if any projects are (still) affected by advisories, or couldn't be audited.
+func runAudit(projects []contempt.Project, partialsDir string) {
+	if *advisories == "" {
+		fatalf(nil, "An advisory database must be specified using -advisories when auditing")
+	}
+
+	db, err := contempt.LoadAdvisories(*advisories)
+	if err != nil {
+		fatalf(nil, "Failed to load advisories: %v", err)
+	}
+
+	affected, failed := auditProjects(db, projects, partialsDir)
+	if affected > 0 && failed > 0 {
+		fatalf(nil, "%d project(s) are affected by advisories, and %d project(s) could not be audited", affected, failed)
+	} else if affected > 0 {
+		fatalf(nil, "%d project(s) are affected by advisories", affected)
+	} else if failed > 0 {
+		fatalf(nil, "%d project(s) could not be audited", failed)
+	}
+
+	writeReport()
+	writeSummary()
+}
+
+// auditProjects audits each project, regenerating affected projects if requested. It returns the number of projects
+// that are (still) affected by advisories, and the number that couldn't be audited.
+func auditProjects(db *contempt.AdvisoryDatabase, projects []contempt.Project, partialsDir string) (affected, failed int) {
+	for i := range projects {
+		r := newProjectReport(projects[i].Name)
+		findings, ok := auditProject(db, projects[i], r)
+		if !ok {
+			failed++
+			continue
+		}
+		if len(findings) == 0 {
+			continue
+		}
+
+		if *auditRegenerate {
+			log.Printf("Regenerating project %s as it is affected by %d advisories", projects[i].Name, len(findings))
+			runProject(projects[i], partialsDir, r, true)
+			findings, ok = auditProject(db, projects[i], r)
+			if !ok {
+				failed++
+				continue
+			}
+		}
+
+		if len(findings) > 0 {
+			affected++
+		}
+	}
+	return affected, failed
+}
+
+// auditProject audits a single project's existing output, logging and recording any findings. If the project's output
+// can't be audited, the failure is recorded in the report and false is returned.
+func auditProject(db *contempt.AdvisoryDatabase, p contempt.Project, r *projectReport) ([]contempt.Finding, bool) {
+	findings, err := db.AuditProject(filepath.Join(p.OutputDir(outputDir), *outputName))
+	if err != nil {
+		r.fail("Failed to audit project %s: %v", p.Name, err)
+		return nil, false
+	}
+
+	r.Advisories = findings
+	for i := range findings {
+		log.Printf("Project %s: %s", p.Name, formatFinding(findings[i]))
+	}
+	return findings, true
+}
+
+// formatFinding describes a finding in a single line.
+func formatFinding(f contempt.Finding) string {
+	res := fmt.Sprintf("%s %s is affected by %s", f.Material, f.Version, f.Advisory)
+	if f.Summary != "" {
+		res += fmt.Sprintf(" (%s)", f.Summary)
+	}
+	if f.Fixed != "" {
+		res += fmt.Sprintf(", fixed in %s", f.Fixed)
+	} else {
+		res += ", no fix available"
+	}
+	return res
+}
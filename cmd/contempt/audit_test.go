@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_auditProjects(t *testing.T) {
+	oldOutputDir := outputDir
+	defer func() { outputDir = oldOutputDir }()
+
+	dir := t.TempDir()
+	outputDir = filepath.Join(dir, "out")
+
+	files := map[string]string{
+		"musl.json":                 `{"id": "ALPINE-CVE-2024-0001", "affected": [{"package": {"ecosystem": "Alpine:v3.19", "name": "musl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.2.4-r3"}]}]}]}`,
+		"out/vulnerable/Dockerfile": "# Generated from test\n# BOM: {\"apk:musl\":\"1.2.4-r1\"}\n\nFROM scratch\n",
+		"out/clean/Dockerfile":      "# Generated from test\n# BOM: {\"apk:musl\":\"1.2.4-r3\"}\n\nFROM scratch\n",
+	}
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0700))
+		require.NoError(t, os.WriteFile(target, []byte(content), 0600))
+	}
+
+	db, err := contempt.LoadAdvisories(filepath.Join(dir, "musl.json"))
+	require.NoError(t, err)
+
+	affected, failed := auditProjects(db, []contempt.Project{
+		{Name: "vulnerable"},
+		{Name: "clean"},
+		{Name: "missing"},
+	}, "")
+
+	assert.Equal(t, 1, affected)
+	assert.Equal(t, 1, failed, "projects whose BOM can't be read should be counted as failures")
+}
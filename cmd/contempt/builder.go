@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+var (
+	builderName = flag.String("builder", "buildah", "The tool to build images with: buildah, podman, docker or kaniko")
+	builderPath = flag.String("builder-path", "", "Path to the builder's executable, if not the default for the chosen builder")
+	buildArgs   = flag.String("build-args", "", "A comma-separated list of KEY=VALUE build arguments to pass to every build")
+	platforms   = flag.String("platforms", "", "A comma-separated list of platforms to build each image for, e.g. linux/amd64,linux/arm64. Projects can override this with 'platforms' in their values")
+)
+
+// buildOptions describes an image to be built.
+type buildOptions struct {
+	// Context is the directory to use as the build context.
+	Context string
+	// File is the path of the Dockerfile to build.
+	File string
+	// Tag is the name to give the built image.
+	Tag string
+	// Reproducible indicates that timestamps in the image should be fixed, so that identical inputs produce
+	// identical images.
+	Reproducible bool
+	// BuildArgs are passed to the build as build arguments.
+	BuildArgs map[string]string
+	// Platforms are the platforms to build the image for, e.g. "linux/arm64". If there are several, a manifest list is
+	// built containing an image for each. If empty, the builder's default is used.
+	Platforms []string
+	// Layout is a directory to export the built image (or manifest list) to as an OCI image layout, so that it can be
+	// pushed. If empty, the image is only kept in the builder's local storage, if it has any.
+	Layout string
+}
+
+// Builder builds container images. Built images are pushed by contempt itself, from the layout the builder exports
+// them to.
+type Builder interface {
+	// Check verifies the builder is installed and working.
+	Check(out io.Writer) error
+	// Build builds an image with the given options.
+	Build(out io.Writer, opts buildOptions) error
+}
+
+// executor runs the named program with the given arguments, writing its output and error streams to out.
+type executor func(out io.Writer, name string, args ...string) error
+
+// runExecutable is an executor that runs programs on the host.
+func runExecutable(out io.Writer, name string, args ...string) error {
+	return runCommand(out, exec.Command(name, args...))
+}
+
+// newBuilder returns the builder with the given name. If path is empty, the default path for the builder is used.
+func newBuilder(name, path string, run executor) (Builder, error) {
+	withDefault := func(def string) string {
+		if path == "" {
+			return def
+		}
+		return path
+	}
+
+	switch name {
+	case "buildah":
+		return &containersBuilder{path: withDefault("/usr/bin/buildah"), buildCommand: "bud", run: run}, nil
+	case "podman":
+		return &containersBuilder{path: withDefault("podman"), buildCommand: "build", run: run}, nil
+	case "docker":
+		return &dockerBuilder{path: withDefault("docker"), run: run}, nil
+	case "kaniko":
+		return &kanikoBuilder{path: withDefault("/kaniko/executor"), run: run}, nil
+	default:
+		return nil, fmt.Errorf("unknown builder %q: must be one of buildah, podman, docker or kaniko", name)
+	}
+}
+
+// parseBuildArgs parses a comma-separated list of KEY=VALUE pairs.
+func parseBuildArgs(value string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, arg := range strings.Split(value, ",") {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+
+		key, val, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid build argument %q: must be in the form KEY=VALUE", arg)
+		}
+		res[key] = val
+	}
+	return res, nil
+}
+
+// splitList splits a comma-separated list, trimming whitespace and ignoring empty entries.
+func splitList(value string) []string {
+	var res []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// buildArgFlags returns the given build arguments as repeated flags, sorted by name.
+func buildArgFlags(flagName string, buildArgs map[string]string) []string {
+	var keys []string
+	for k := range buildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res []string
+	for i := range keys {
+		res = append(res, flagName, fmt.Sprintf("%s=%s", keys[i], buildArgs[keys[i]]))
+	}
+	return res
+}
+
+// containersBuilder builds images using buildah or podman, which share most of their options. Both can be run
+// rootless. Images for multiple platforms are built into a local manifest list.
+type containersBuilder struct {
+	path         string
+	buildCommand string
+	run          executor
+}
+
+func (c *containersBuilder) Check(out io.Writer) error {
+	return c.run(out, c.path, "--version")
+}
+
+func (c *containersBuilder) Build(out io.Writer, opts buildOptions) error {
+	args := []string{c.buildCommand}
+	if opts.Reproducible {
+		args = append(args, "--timestamp", "0")
+	}
+	args = append(args, "--layers")
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	args = append(args, buildArgFlags("--build-arg", opts.BuildArgs)...)
+	if opts.File != "" {
+		args = append(args, "--file", opts.File)
+	}
+
+	multiPlatform := len(opts.Platforms) > 1
+	if multiPlatform {
+		// Building into an existing manifest list adds to it, so remove any left over from a previous build. This
+		// fails if there isn't one, which is fine.
+		_ = c.run(io.Discard, c.path, "manifest", "rm", opts.Tag)
+		args = append(args, "--manifest", opts.Tag, opts.Context)
+	} else {
+		args = append(args, "--tag", opts.Tag, opts.Context)
+	}
+
+	if err := c.run(out, c.path, args...); err != nil {
+		return err
+	}
+
+	if opts.Layout == "" {
+		return nil
+	} else if multiPlatform {
+		return c.run(out, c.path, "manifest", "push", "--all", opts.Tag, "oci:"+opts.Layout)
+	}
+	return c.run(out, c.path, "push", opts.Tag, "oci:"+opts.Layout)
+}
+
+// dockerBuilder builds images using docker buildx. Docker's image store can't hold images for multiple platforms, so
+// they are only exported to a layout (or kept in the build cache, if they're not being pushed).
+type dockerBuilder struct {
+	path string
+	run  executor
+	// legacyDriver indicates that buildx is using the "docker" driver with the classic image store, which can only
+	// build images for a single platform into the image store.
+	legacyDriver bool
+}
+
+func (d *dockerBuilder) Check(out io.Writer) error {
+	if err := d.run(out, d.path, "buildx", "version"); err != nil {
+		return err
+	}
+
+	inspect := &bytes.Buffer{}
+	if err := d.run(inspect, d.path, "buildx", "inspect"); err != nil {
+		return err
+	}
+	if buildxDriver(inspect.String()) != "docker" {
+		return nil
+	}
+
+	// The docker driver can export OCI images if docker is using the containerd image store.
+	info := &bytes.Buffer{}
+	if err := d.run(info, d.path, "info", "--format", "{{json .DriverStatus}}"); err != nil {
+		return err
+	}
+	d.legacyDriver = !strings.Contains(info.String(), "io.containerd.snapshotter")
+	return nil
+}
+
+// buildxDriver returns the driver of the current builder from the output of "docker buildx inspect".
+func buildxDriver(inspect string) string {
+	for _, line := range strings.Split(inspect, "\n") {
+		if key, value, found := strings.Cut(line, ":"); found && strings.TrimSpace(key) == "Driver" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func (d *dockerBuilder) Build(out io.Writer, opts buildOptions) error {
+	if d.legacyDriver && (opts.Layout != "" || len(opts.Platforms) > 1) {
+		return fmt.Errorf("the docker buildx driver can't export images or build them for multiple platforms: " +
+			"use a docker-container builder (docker buildx create --use --driver docker-container) " +
+			"or enable docker's containerd image store")
+	}
+
+	args := []string{"buildx", "build"}
+	if opts.Reproducible {
+		// BuildKit uses SOURCE_DATE_EPOCH for the image's timestamps, and only rewrites the timestamps of files in
+		// the layers when asked to.
+		args = append(args, "--build-arg", "SOURCE_DATE_EPOCH=0")
+	}
+
+	output := "type=docker"
+	if opts.Layout != "" {
+		output = fmt.Sprintf("type=oci,dest=%s,tar=false", opts.Layout)
+	} else if len(opts.Platforms) > 1 {
+		output = "type=cacheonly"
+	}
+	if opts.Reproducible && output != "type=cacheonly" {
+		output += ",rewrite-timestamp=true"
+	}
+	args = append(args, "--output", output)
+
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	args = append(args, buildArgFlags("--build-arg", opts.BuildArgs)...)
+	if opts.File != "" {
+		args = append(args, "--file", opts.File)
+	}
+	args = append(args, "--tag", opts.Tag, opts.Context)
+	return d.run(out, d.path, args...)
+}
+
+// kanikoBuilder builds images using the kaniko executor. Kaniko doesn't keep built images locally, so they are only
+// exported to a layout, and can't be built for multiple platforms at once.
+type kanikoBuilder struct {
+	path string
+	run  executor
+}
+
+func (k *kanikoBuilder) Check(out io.Writer) error {
+	return k.run(out, k.path, "version")
+}
+
+func (k *kanikoBuilder) Build(out io.Writer, opts buildOptions) error {
+	if len(opts.Platforms) > 1 {
+		return fmt.Errorf("kaniko can't build images for multiple platforms")
+	}
+
+	args := []string{"--context", opts.Context}
+	if opts.File != "" {
+		args = append(args, "--dockerfile", opts.File)
+	}
+	args = append(args, "--destination", opts.Tag)
+	if opts.Reproducible {
+		args = append(args, "--reproducible")
+	}
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--custom-platform", opts.Platforms[0])
+	}
+	args = append(args, buildArgFlags("--build-arg", opts.BuildArgs)...)
+	args = append(args, "--no-push")
+	if opts.Layout != "" {
+		args = append(args, "--oci-layout-path", opts.Layout)
+	}
+	return k.run(out, k.path, args...)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor records the commands it is asked to run, writing any configured output for them.
+type fakeExecutor struct {
+	commands [][]string
+	// outputs maps space-separated arguments to the output the command should write.
+	outputs map[string]string
+}
+
+func (f *fakeExecutor) run(out io.Writer, name string, args ...string) error {
+	f.commands = append(f.commands, append([]string{name}, args...))
+	_, err := io.WriteString(out, f.outputs[strings.Join(args, " ")])
+	return err
+}
+
+var testBuildOptions = buildOptions{
+	Context:      "out/tools/web",
+	File:         "out/tools/web/Dockerfile",
+	Tag:          "reg.example.com/tools/web",
+	Reproducible: true,
+	BuildArgs:    map[string]string{"b": "2", "a": "1"},
+	Platforms:    []string{"linux/arm64"},
+	Layout:       "/tmp/layout",
+}
+
+func Test_newBuilder_unknown(t *testing.T) {
+	_, err := newBuilder("bazel", "", runExecutable)
+	assert.Error(t, err)
+}
+
+func Test_buildah(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("buildah", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Check(io.Discard))
+	require.NoError(t, b.Build(io.Discard, testBuildOptions))
+
+	assert.Equal(t, [][]string{
+		{"/usr/bin/buildah", "--version"},
+		{
+			"/usr/bin/buildah", "bud", "--timestamp", "0", "--layers", "--platform", "linux/arm64",
+			"--build-arg", "a=1", "--build-arg", "b=2", "--file", "out/tools/web/Dockerfile",
+			"--tag", "reg.example.com/tools/web", "out/tools/web",
+		},
+		{"/usr/bin/buildah", "push", "reg.example.com/tools/web", "oci:/tmp/layout"},
+	}, f.commands)
+}
+
+func Test_buildah_minimalOptions(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("buildah", "/opt/buildah", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Build(io.Discard, buildOptions{Context: "out/web", Tag: "reg/web"}))
+	assert.Equal(t, [][]string{{"/opt/buildah", "bud", "--layers", "--tag", "reg/web", "out/web"}}, f.commands)
+}
+
+func Test_buildah_multiPlatform(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("buildah", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Build(io.Discard, buildOptions{
+		Context:   "out/web",
+		Tag:       "reg/web",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		Layout:    "/tmp/layout",
+	}))
+
+	assert.Equal(t, [][]string{
+		{"/usr/bin/buildah", "manifest", "rm", "reg/web"},
+		{"/usr/bin/buildah", "bud", "--layers", "--platform", "linux/amd64,linux/arm64", "--manifest", "reg/web", "out/web"},
+		{"/usr/bin/buildah", "manifest", "push", "--all", "reg/web", "oci:/tmp/layout"},
+	}, f.commands)
+}
+
+func Test_podman(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("podman", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Check(io.Discard))
+	require.NoError(t, b.Build(io.Discard, testBuildOptions))
+
+	assert.Equal(t, [][]string{
+		{"podman", "--version"},
+		{
+			"podman", "build", "--timestamp", "0", "--layers", "--platform", "linux/arm64",
+			"--build-arg", "a=1", "--build-arg", "b=2", "--file", "out/tools/web/Dockerfile",
+			"--tag", "reg.example.com/tools/web", "out/tools/web",
+		},
+		{"podman", "push", "reg.example.com/tools/web", "oci:/tmp/layout"},
+	}, f.commands)
+}
+
+func Test_docker(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("docker", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Check(io.Discard))
+	require.NoError(t, b.Build(io.Discard, testBuildOptions))
+
+	assert.Equal(t, [][]string{
+		{"docker", "buildx", "version"},
+		{"docker", "buildx", "inspect"},
+		{
+			"docker", "buildx", "build", "--build-arg", "SOURCE_DATE_EPOCH=0",
+			"--output", "type=oci,dest=/tmp/layout,tar=false,rewrite-timestamp=true", "--platform", "linux/arm64",
+			"--build-arg", "a=1", "--build-arg", "b=2", "--file", "out/tools/web/Dockerfile",
+			"--tag", "reg.example.com/tools/web", "out/tools/web",
+		},
+	}, f.commands)
+}
+
+func Test_docker_withoutLayout(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("docker", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Build(io.Discard, buildOptions{Context: "out/web", Tag: "reg/web"}))
+	require.NoError(t, b.Build(io.Discard, buildOptions{
+		Context:   "out/web",
+		Tag:       "reg/web",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+	}))
+
+	assert.Equal(t, [][]string{
+		{"docker", "buildx", "build", "--output", "type=docker", "--tag", "reg/web", "out/web"},
+		{
+			"docker", "buildx", "build", "--output", "type=cacheonly", "--platform", "linux/amd64,linux/arm64",
+			"--tag", "reg/web", "out/web",
+		},
+	}, f.commands)
+}
+
+func Test_docker_drivers(t *testing.T) {
+	tests := []struct {
+		name        string
+		outputs     map[string]string
+		wantCommand []string
+		wantErr     bool
+	}{
+		{
+			"docker-container driver",
+			map[string]string{"buildx inspect": "Name:          builder\nDriver:        docker-container\n"},
+			nil,
+			false,
+		},
+		{
+			"docker driver with containerd image store",
+			map[string]string{
+				"buildx inspect":                       "Name:          default\nDriver:        docker\n",
+				"info --format {{json .DriverStatus}}": `[["driver-type","io.containerd.snapshotter.v1"]]`,
+			},
+			[]string{"docker", "info", "--format", "{{json .DriverStatus}}"},
+			false,
+		},
+		{
+			"docker driver with classic image store",
+			map[string]string{
+				"buildx inspect":                       "Name:          default\nDriver:        docker\n",
+				"info --format {{json .DriverStatus}}": `[["Backing Filesystem","extfs"]]`,
+			},
+			[]string{"docker", "info", "--format", "{{json .DriverStatus}}"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeExecutor{outputs: tt.outputs}
+			b, err := newBuilder("docker", "", f.run)
+			require.NoError(t, err)
+
+			require.NoError(t, b.Check(io.Discard))
+			if tt.wantCommand != nil {
+				assert.Contains(t, f.commands, tt.wantCommand)
+			}
+
+			// Images can still be built into the image store for a single platform.
+			assert.NoError(t, b.Build(io.Discard, buildOptions{Context: "out/web", Tag: "reg/web"}))
+
+			err = b.Build(io.Discard, testBuildOptions)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "docker-container")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_kaniko(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("kaniko", "", f.run)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Check(io.Discard))
+	require.NoError(t, b.Build(io.Discard, testBuildOptions))
+
+	assert.Equal(t, [][]string{
+		{"/kaniko/executor", "version"},
+		{
+			"/kaniko/executor", "--context", "out/tools/web", "--dockerfile", "out/tools/web/Dockerfile",
+			"--destination", "reg.example.com/tools/web", "--reproducible", "--custom-platform", "linux/arm64",
+			"--build-arg", "a=1", "--build-arg", "b=2", "--no-push", "--oci-layout-path", "/tmp/layout",
+		},
+	}, f.commands)
+}
+
+func Test_kaniko_multiPlatform(t *testing.T) {
+	f := &fakeExecutor{}
+	b, err := newBuilder("kaniko", "", f.run)
+	require.NoError(t, err)
+
+	assert.Error(t, b.Build(io.Discard, buildOptions{Tag: "reg/web", Platforms: []string{"linux/amd64", "linux/arm64"}}))
+	assert.Empty(t, f.commands)
+}
+
+func Test_splitList(t *testing.T) {
+	assert.Equal(t, []string{"linux/amd64", "linux/arm/v7"}, splitList("linux/amd64, linux/arm/v7,"))
+	assert.Nil(t, splitList(""))
+}
+
+func Test_parseBuildArgs(t *testing.T) {
+	args, err := parseBuildArgs("FOO=bar, EMPTY=,URL=https://example.com/?a=b")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"FOO": "bar", "EMPTY": "", "URL": "https://example.com/?a=b"}, args)
+
+	args, err = parseBuildArgs("")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	_, err = parseBuildArgs("FOO")
+	assert.Error(t, err)
+
+	_, err = parseBuildArgs("=bar")
+	assert.Error(t, err)
+}
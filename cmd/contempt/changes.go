@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/csmith/contempt"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	refuseDowngrades = flag.Bool("refuse-downgrades", false, "Whether to refuse to update projects where a material would be downgraded, unless approved")
+	refuseMajor      = flag.Bool("refuse-major", false, "Whether to refuse to update projects where a material would have a major version bump, unless approved")
+	approve          = flag.String("approve", "", "A comma-separated list of projects or materials that are approved for downgrades and major version bumps")
+	policyWarnOnly   = flag.Bool("policy-warn-only", false, "Whether to only warn about policy violations, instead of refusing to update the project")
+)
+
+// refusedChanges returns an error listing any changes that aren't permitted by the -refuse-downgrades and
+// -refuse-major flags, and haven't been explicitly approved using the -approve flag.
+func refusedChanges(project string, changes []contempt.Change) error {
+	approved := strings.Split(*approve, ",")
+	if slices.Contains(approved, project) {
+		return nil
+	}
+
+	var refused []string
+	for i := range changes {
+		if slices.Contains(approved, changes[i].Material) {
+			continue
+		}
+
+		if *refuseDowngrades && changes[i].Kind == contempt.Downgraded {
+			refused = append(refused, fmt.Sprintf("%s would be downgraded from %s to %s", changes[i].Material, changes[i].OldVersion(), changes[i].NewVersion()))
+		} else if *refuseMajor && changes[i].Kind == contempt.Upgraded && changes[i].Bump == contempt.MajorBump {
+			refused = append(refused, fmt.Sprintf("%s would have a major version bump from %s to %s", changes[i].Material, changes[i].OldVersion(), changes[i].NewVersion()))
+		}
+	}
+
+	if len(refused) > 0 {
+		return fmt.Errorf("unapproved changes: %s", strings.Join(refused, "; "))
+	}
+	return nil
+}
+
+// changeMarker returns a marker describing the most significant of the given changes: "downgrade" if any material
+// was downgraded, otherwise the largest version bump of any upgraded material. If no changes can be classified, an
+// empty string is returned.
+func changeMarker(changes []contempt.Change) string {
+	marker := ""
+	for i := range changes {
+		if changes[i].Kind == contempt.Downgraded {
+			return "downgrade"
+		}
+
+		if changes[i].Kind == contempt.Upgraded {
+			if changes[i].Bump == contempt.MajorBump {
+				marker = string(contempt.MajorBump)
+			} else if changes[i].Bump == contempt.MinorBump && marker != string(contempt.MajorBump) {
+				marker = string(contempt.MinorBump)
+			} else if changes[i].Bump == contempt.PatchBump && marker == "" {
+				marker = string(contempt.PatchBump)
+			}
+		}
+	}
+	return marker
+}
+
+// commitMessage builds the commit message used when committing changes to a project.
+func commitMessage(project string, changes []contempt.Change) string {
+	if marker := changeMarker(changes); marker != "" {
+		return fmt.Sprintf("[%s] [%s] %s", project, marker, formatChanges(changes))
+	}
+	return fmt.Sprintf("[%s] %s", project, formatChanges(changes))
+}
+
+// policyViolations returns an error listing the given violations, or nil if there are none or -policy-warn-only is
+// set (in which case they are logged as warnings instead).
+func policyViolations(r *projectReport, violations []contempt.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	var messages []string
+	for i := range violations {
+		messages = append(messages, violations[i].Error())
+	}
+
+	if *policyWarnOnly {
+		for i := range messages {
+			if *workflowCommands {
+				_, _ = fmt.Fprintf(r.output, "::warning title=Policy violation in %s::%s\n", r.Name, messages[i])
+			} else {
+				r.logf("Warning: policy violation in %s: %s", r.Name, messages[i])
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("policy violations: %s", strings.Join(messages, "; "))
+}
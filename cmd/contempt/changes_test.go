@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+)
+
+func change(material string, kind contempt.ChangeKind, bump contempt.VersionBump) contempt.Change {
+	return contempt.Change{
+		Material: material,
+		Kind:     kind,
+		Bump:     bump,
+		Old:      &contempt.Material{Version: "1.0.0"},
+		New:      &contempt.Material{Version: "2.0.0"},
+	}
+}
+
+func Test_changeMarker(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []contempt.Change
+		want    string
+	}{
+		{"No changes", nil, ""},
+		{"Unclassified changes", []contempt.Change{change("image:alpine", contempt.Changed, "")}, ""},
+		{"Additions only", []contempt.Change{change("apk:foo", contempt.Added, "")}, ""},
+		{
+			"Largest bump wins",
+			[]contempt.Change{
+				change("apk:a", contempt.Upgraded, contempt.PatchBump),
+				change("apk:b", contempt.Upgraded, contempt.MajorBump),
+				change("apk:c", contempt.Upgraded, contempt.MinorBump),
+			},
+			"major",
+		},
+		{
+			"Downgrades win",
+			[]contempt.Change{
+				change("apk:a", contempt.Upgraded, contempt.MajorBump),
+				change("apk:b", contempt.Downgraded, contempt.PatchBump),
+			},
+			"downgrade",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, changeMarker(tt.changes))
+		})
+	}
+}
+
+func Test_refusedChanges(t *testing.T) {
+	tests := []struct {
+		name             string
+		refuseDowngrades bool
+		refuseMajor      bool
+		approve          string
+		changes          []contempt.Change
+		wantErr          bool
+	}{
+		{
+			"Allows everything by default",
+			false,
+			false,
+			"",
+			[]contempt.Change{change("apk:a", contempt.Downgraded, contempt.MajorBump), change("apk:b", contempt.Upgraded, contempt.MajorBump)},
+			false,
+		},
+		{
+			"Refuses downgrades",
+			true,
+			false,
+			"",
+			[]contempt.Change{change("apk:a", contempt.Downgraded, contempt.PatchBump)},
+			true,
+		},
+		{
+			"Refuses major bumps",
+			false,
+			true,
+			"",
+			[]contempt.Change{change("apk:a", contempt.Upgraded, contempt.MajorBump)},
+			true,
+		},
+		{
+			"Allows minor bumps when refusing major bumps",
+			true,
+			true,
+			"",
+			[]contempt.Change{change("apk:a", contempt.Upgraded, contempt.MinorBump)},
+			false,
+		},
+		{
+			"Allows approved materials",
+			true,
+			true,
+			"apk:b,apk:a",
+			[]contempt.Change{change("apk:a", contempt.Downgraded, contempt.PatchBump)},
+			false,
+		},
+		{
+			"Allows approved projects",
+			true,
+			true,
+			"project",
+			[]contempt.Change{change("apk:a", contempt.Upgraded, contempt.MajorBump)},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*refuseDowngrades = tt.refuseDowngrades
+			*refuseMajor = tt.refuseMajor
+			*approve = tt.approve
+
+			err := refusedChanges("project", tt.changes)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/csmith/contempt"
+)
+
+var (
+	graphFormat   = flag.String("graph-format", "dot", "Format to output the dependency graph in: dot, mermaid or json")
+	graphExternal = flag.Bool("graph-external", false, "Whether to include images from outside the repo in the dependency graph")
+)
+
+// graphNode is a single project or external image in the dependency graph.
+type graphNode struct {
+	name     string
+	external bool
+	deps     []string
+}
+
+// writeGraph writes the dependency graph of the given projects in the format given by the -graph-format flag. Edges
+// point from each project to the images it depends on.
+func writeGraph(writer io.Writer, projects []contempt.Project) error {
+	nodes := graphNodes(projects, *graphExternal)
+
+	var output string
+	switch *graphFormat {
+	case "dot":
+		output = formatDot(nodes)
+	case "mermaid":
+		output = formatMermaid(nodes)
+	case "json":
+		adjacency := make(map[string][]string, len(nodes))
+		for i := range nodes {
+			adjacency[nodes[i].name] = append([]string{}, nodes[i].deps...)
+		}
+		bs, err := json.MarshalIndent(adjacency, "", "  ")
+		if err != nil {
+			return err
+		}
+		output = string(bs) + "\n"
+	default:
+		return fmt.Errorf("unknown graph format: %s", *graphFormat)
+	}
+
+	_, err := io.WriteString(writer, output)
+	return err
+}
+
+// graphNodes returns a node for each project, and optionally for each external image, sorted by name.
+func graphNodes(projects []contempt.Project, external bool) []graphNode {
+	var nodes []graphNode
+	seen := make(map[string]bool)
+	for i := range projects {
+		deps := append([]string{}, projects[i].Dependencies...)
+		if external {
+			deps = append(deps, projects[i].ExternalImages...)
+			for _, image := range projects[i].ExternalImages {
+				if !seen[image] {
+					seen[image] = true
+					nodes = append(nodes, graphNode{name: image, external: true})
+				}
+			}
+		}
+		sort.Strings(deps)
+		nodes = append(nodes, graphNode{name: projects[i].Name, deps: deps})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	return nodes
+}
+
+// formatDot formats the graph for Graphviz.
+func formatDot(nodes []graphNode) string {
+	builder := &strings.Builder{}
+	builder.WriteString("digraph contempt {\n")
+	for i := range nodes {
+		if nodes[i].external {
+			builder.WriteString(fmt.Sprintf("  %q [shape=box, style=dashed];\n", nodes[i].name))
+		} else {
+			builder.WriteString(fmt.Sprintf("  %q;\n", nodes[i].name))
+		}
+	}
+	for i := range nodes {
+		for _, dep := range nodes[i].deps {
+			builder.WriteString(fmt.Sprintf("  %q -> %q;\n", nodes[i].name, dep))
+		}
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// formatMermaid formats the graph as a Mermaid flowchart. Image names can't be used as Mermaid IDs, so each node is
+// given a numeric ID and labelled with its name.
+func formatMermaid(nodes []graphNode) string {
+	ids := make(map[string]string, len(nodes))
+	for i := range nodes {
+		ids[nodes[i].name] = fmt.Sprintf("n%d", i)
+	}
+
+	builder := &strings.Builder{}
+	builder.WriteString("flowchart LR\n")
+	for i := range nodes {
+		if nodes[i].external {
+			builder.WriteString(fmt.Sprintf("  %s[(\"%s\")]\n", ids[nodes[i].name], nodes[i].name))
+		} else {
+			builder.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[nodes[i].name], nodes[i].name))
+		}
+	}
+	for i := range nodes {
+		for _, dep := range nodes[i].deps {
+			builder.WriteString(fmt.Sprintf("  %s --> %s\n", ids[nodes[i].name], ids[dep]))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+)
+
+var graphProjects = []contempt.Project{
+	{Name: "base", ExternalImages: []string{"docker.io/library/alpine"}},
+	{Name: "tools/web", Dependencies: []string{"base"}, ExternalImages: []string{"docker.io/library/alpine"}},
+}
+
+func Test_formatDot(t *testing.T) {
+	assert.Equal(t, `digraph contempt {
+  "base";
+  "docker.io/library/alpine" [shape=box, style=dashed];
+  "tools/web";
+  "base" -> "docker.io/library/alpine";
+  "tools/web" -> "base";
+  "tools/web" -> "docker.io/library/alpine";
+}
+`, formatDot(graphNodes(graphProjects, true)))
+}
+
+func Test_formatMermaid(t *testing.T) {
+	assert.Equal(t, `flowchart LR
+  n0["base"]
+  n1["tools/web"]
+  n1 --> n0
+`, formatMermaid(graphNodes(graphProjects, false)))
+}
+
+func Test_writeGraph_json(t *testing.T) {
+	*graphFormat = "json"
+	defer func() { *graphFormat = "dot" }()
+
+	builder := &strings.Builder{}
+	assert.NoError(t, writeGraph(builder, graphProjects))
+	assert.JSONEq(t, `{"base":[],"tools/web":["base"]}`, builder.String())
+}
@@ -3,164 +3,511 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/csmith/contempt"
+	"github.com/csmith/contempt/internal"
 	"github.com/csmith/contempt/sources"
 	"github.com/csmith/envflag"
-	"golang.org/x/exp/slices"
 )
 
 var (
-	templateName     = flag.String("template", "Dockerfile.gotpl", "The name of the template files")
-	outputName       = flag.String("output", "Dockerfile", "The name of the output files")
-	filter           = flag.String("project", "", "A comma-separated list of projects to generate, instead of all detected ones")
-	sourceLink       = flag.String("source-link", "https://github.com/example/repo/blob/master/", "Link to a browsable version of the source repo")
-	commit           = flag.Bool("commit", false, "Whether to automatically git commit each changed file")
-	build            = flag.Bool("build", false, "Whether to automatically build on successful commit")
-	forceBuild       = flag.Bool("force-build", false, "Whether to build projects regardless of changes")
-	push             = flag.Bool("push", false, "Whether to automatically push on successful commit")
-	pushRetries      = flag.Int("push-retries", 2, "How many times to retry pushing an image if it fails")
-	workflowCommands = flag.Bool("workflow-commands", true, "Whether to output GitHub Actions workflow commands to format logs")
+	templateName      = flag.String("template", "Dockerfile.gotpl", "The name of the template files")
+	outputName        = flag.String("output", "Dockerfile", "The name of the output files")
+	partials          = flag.String("partials", "_templates", "Directory, relative to the input dir, containing shared templates available to all projects")
+	changedSince      = flag.String("changed-since", "", "Only process projects with files changed since the given git ref, and their dependents")
+	filter            = flag.String("project", "", "A comma-separated list of projects to generate, instead of all detected ones. Prefix a project with + to include its dependents, or suffix it with + to include its dependencies")
+	sourceLink        = flag.String("source-link", "https://github.com/example/repo/blob/master/", "Link to a browsable version of the source repo")
+	check             = flag.Bool("check", false, "Whether to only check if outputs are up-to-date, printing a diff and exiting with an error if not")
+	sbom              = flag.Bool("sbom", false, "Whether to write CycloneDX and SPDX SBOMs alongside each output file")
+	commit            = flag.Bool("commit", false, "Whether to automatically git commit each changed file")
+	build             = flag.Bool("build", false, "Whether to automatically build on successful commit")
+	forceBuild        = flag.Bool("force-build", false, "Whether to build projects regardless of changes")
+	push              = flag.Bool("push", false, "Whether to automatically push on successful commit")
+	pushRetries       = flag.Int("push-retries", 2, "How many times to retry pushing an image if it fails")
+	rebuildDependents = flag.Bool("rebuild-dependents", true, "Whether to regenerate projects whose dependencies were pushed during the run, even if they weren't selected")
+	workflowCommands  = flag.Bool("workflow-commands", true, "Whether to output GitHub Actions workflow commands to format logs")
+)
+
+// inputDir and outputDir are the directories given as positional arguments.
+var inputDir, outputDir string
+
+var (
+	// imageBuilder is used to build and push images, as chosen by the -builder flag.
+	imageBuilder Builder
+	// imageBuildArgs are the build arguments given by the -build-args flag.
+	imageBuildArgs map[string]string
 )
 
 func main() {
 	envflag.Parse()
 
-	if flag.NArg() != 2 {
-		_, _ = fmt.Fprintf(os.Stderr, "Required arguments missing: <input dir> <output dir>\n")
+	// Allow flags to be given after the subcommand, e.g. "contempt audit -advisories db.zip in out".
+	command := flag.Arg(0)
+	if command == "audit" || command == "graph" {
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			os.Exit(2)
+		}
+	} else {
+		command = ""
+	}
+
+	if command == "graph" && flag.NArg() != 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Required arguments missing: graph <input dir>\n")
+		flag.Usage()
+		os.Exit(2)
+	} else if command != "graph" && flag.NArg() != 2 {
+		_, _ = fmt.Fprintf(os.Stderr, "Required arguments missing: [audit] <input dir> <output dir>\n")
 		flag.Usage()
 		os.Exit(2)
 	}
 
-	projectDir, err := filepath.Abs(flag.Arg(0))
+	inputDir, outputDir = flag.Arg(0), flag.Arg(1)
+
+	projectDir, err := filepath.Abs(inputDir)
+	if err != nil {
+		fatalf(nil, "Failed to resolve project directory: %v", err)
+	}
+
+	partialsDir := filepath.Join(projectDir, *partials)
+
+	projects, err := contempt.FindProjects(projectDir, *templateName, partialsDir)
 	if err != nil {
-		log.Fatalf("Failed to resolve project directory: %v", err)
+		fatalf(nil, "Failed to find projects: %v", err)
+	}
+
+	if command == "graph" {
+		if err := writeGraph(os.Stdout, projects); err != nil {
+			fatalf(nil, "Failed to write graph: %v", err)
+		}
+		return
 	}
 
-	projects, err := contempt.FindProjects(projectDir, *templateName)
+	imageBuilder, err = newBuilder(*builderName, *builderPath, runExecutable)
 	if err != nil {
-		log.Fatalf("Failed to find projects: %v", err)
+		fatalf(nil, "Invalid builder: %v", err)
+	}
+
+	imageBuildArgs, err = parseBuildArgs(*buildArgs)
+	if err != nil {
+		fatalf(nil, "Invalid build arguments: %v", err)
+	}
+
+	pushTargets, err = parsePushTargets(*pushTo)
+	if err != nil {
+		fatalf(nil, "Invalid -push-to: %v", err)
 	}
 
 	checkExternalDependencies()
 
-	filtered := strings.Split(*filter, ",")
+	selection := selectProjects(projects, *filter)
+	if *changedSince != "" {
+		files, err := internal.ChangedFiles(projectDir, *changedSince)
+		if err != nil {
+			fatalf(nil, "Failed to determine changed projects: %v", err)
+		}
+
+		changed := changedProjects(projects, files, filepath.ToSlash(filepath.Clean(*partials)))
+		for name := range selection {
+			if !changed[name] {
+				delete(selection, name)
+			}
+		}
+		log.Printf("%d project(s) affected by changes since %s", len(selection), *changedSince)
+	}
 
+	var selected []contempt.Project
 	for i := range projects {
-		if *filter == "" || slices.Contains(filtered, projects[i]) {
-			if *workflowCommands {
-				fmt.Printf("::group::%s\n", projects[i])
+		if selection[projects[i].Name] {
+			selected = append(selected, projects[i])
+		}
+	}
+
+	if command == "audit" {
+		runAudit(selected, partialsDir)
+		return
+	}
+
+	// Any dependents of a project that has just been pushed are regenerated to pick up the new image in the same run,
+	// even if they weren't selected.
+	results := schedule(projects, *workers, func(p contempt.Project, dependenciesPushed bool) bool {
+		return selection[p.Name] || (*rebuildDependents && dependenciesPushed)
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		r := newProjectReport(p.Name)
+		return runProject(p, partialsDir, r, false), r.Push == stepSucceeded
+	}, skipProject)
+
+	var refused, violating, failed []string
+	for i := range results {
+		switch results[i].outcome {
+		case projectRefused:
+			refused = append(refused, results[i].name)
+		case projectViolatesPolicy:
+			violating = append(violating, results[i].name)
+		case projectFailed:
+			failed = append(failed, results[i].name)
+		}
+	}
+
+	var partial []string
+	for i := range report.Projects {
+		if report.Projects[i].mirrorsFailed() > 0 {
+			partial = append(partial, report.Projects[i].Name)
+		}
+	}
+
+	if message := runError(failed, partial, violating, refused); message != "" {
+		fatalf(nil, "%s", message)
+	}
+
+	writeReport()
+	writeSummary()
+}
+
+// projectOutcome describes the result of processing a single project.
+type projectOutcome int
+
+const (
+	// projectSucceeded indicates the project was processed successfully.
+	projectSucceeded projectOutcome = iota
+	// projectRefused indicates the project wasn't updated, because its changes were refused or, when running with
+	// -check, because it is out of date. Its dependents can still be processed.
+	projectRefused
+	// projectViolatesPolicy indicates the project wasn't updated because its materials violate the policy. Its
+	// dependents can still be processed.
+	projectViolatesPolicy
+	// projectFailed indicates an error occurred while processing the project, so its dependents can't be processed.
+	projectFailed
+)
+
+// runError describes why the run as a whole failed, given the names of the projects that failed, couldn't be copied
+// to every registry, violated the policy, or were refused (or are out of date, when running with -check). If nothing
+// went wrong, an empty string is returned.
+func runError(failed, partial, violating, refused []string) string {
+	if len(failed) > 0 {
+		return fmt.Sprintf("%d project(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	} else if len(partial) > 0 {
+		return fmt.Sprintf("%d project(s) couldn't be copied to every registry: %s", len(partial), strings.Join(partial, ", "))
+	}
+
+	var problems []string
+	if len(violating) > 0 {
+		problems = append(problems, fmt.Sprintf("%d project(s) violate the policy: %s", len(violating), strings.Join(violating, ", ")))
+	}
+	if len(refused) > 0 && *check {
+		problems = append(problems, "One or more projects are out of date")
+	} else if len(refused) > 0 {
+		problems = append(problems, "One or more projects were not updated due to unapproved changes")
+	}
+	return strings.Join(problems, ". ")
+}
+
+// runProject processes a single project. Its output is wrapped in a group if workflow commands are enabled; if the
+// project's output is being buffered, it is printed once the project has finished.
+func runProject(p contempt.Project, partialsDir string, r *projectReport, rebuild bool) projectOutcome {
+	if r.buffer == nil && *workflowCommands {
+		fmt.Printf("::group::%s\n", p.Name)
+		defer fmt.Printf("::endgroup::\n")
+	} else if r.buffer != nil {
+		defer r.flush()
+	}
+	return processProject(p, partialsDir, r, rebuild)
+}
+
+// skipProject records that a project was skipped because one of its dependencies failed.
+func skipProject(p contempt.Project, dependency string) {
+	r := newProjectReport(p.Name)
+	r.fail("Skipping project %s as its dependency %s failed", p.Name, dependency)
+	if r.buffer != nil {
+		r.flush()
+	}
+}
+
+// processProject generates, commits, builds and pushes a single project as configured by flags. If rebuild is true,
+// the project's image is built even if it would otherwise be skipped.
+func processProject(p contempt.Project, partialsDir string, r *projectReport, rebuild bool) projectOutcome {
+	r.logf("Checking project %s", p.Name)
+	outDir := p.OutputDir(outputDir)
+
+	var result *contempt.Result
+	if err := r.timed("generate", func() (err error) {
+		result, err = contempt.Render(*sourceLink, inputDir, p, outDir, *outputName, partialsDir)
+		return err
+	}); err != nil {
+		r.fail("Failed to generate project %s: %v", p.Name, err)
+		return projectFailed
+	}
+
+	r.Changed = result.Changed()
+	r.Changes = append(r.Changes, result.Changes...)
+	r.Violations = result.Violations
+
+	if err := policyViolations(r, result.Violations); err != nil {
+		r.fail("Refusing to update project %s: %v", p.Name, err)
+		return projectViolatesPolicy
+	}
+
+	if *check {
+		return checkProject(r, result)
+	}
+
+	if err := refusedChanges(p.Name, result.Changes); err != nil {
+		r.fail("Refusing to update project %s: %v", p.Name, err)
+		return projectRefused
+	}
+
+	if err := result.Write(); err != nil {
+		r.fail("Failed to write project %s: %v", p.Name, err)
+		return projectFailed
+	}
+	files := result.FileNames()
+
+	if *sbom {
+		// SBOMs include a creation time, so only regenerate them when something has actually changed.
+		if len(result.Changes) > 0 || !sbomsExist(outDir) {
+			sbomFiles, err := contempt.WriteSBOMs(*sourceLink, p.Name, outDir, result.Materials)
+			if err != nil {
+				r.fail("Failed to write SBOMs for project %s: %v", p.Name, err)
+				return projectFailed
+			}
+			files = append(files, sbomFiles...)
+		}
+	}
+
+	// Only build projects that have been committed, unless a build has been forced.
+	changed := result.Changed() || len(files) > len(result.Files)
+	if *commit && changed {
+		if err := r.timed("commit", func() error {
+			return doCommit(r, p.Name, files, result.Changes)
+		}); err != nil {
+			r.fail("Failed to commit %s: %v", p.Name, err)
+			return projectFailed
+		}
+	} else if *commit {
+		r.logf("No changes to commit for %s", p.Name)
+	}
+
+	if (*commit && *build && changed) || *forceBuild || rebuild {
+		imageName := fmt.Sprintf("%s/%s", sources.Registry(), p.Name)
+		r.Image = imageName
+
+		imagePlatforms := p.Platforms
+		if imagePlatforms == nil {
+			imagePlatforms = splitList(*platforms)
+		}
+
+		// Resolve the tags before building, so that a broken template doesn't leave a partially tagged image.
+		var tags []string
+		if *push {
+			templates := p.Tags
+			if templates == nil {
+				templates = splitList(*tagTemplates)
 			}
-			log.Printf("Checking project %s", projects[i])
-			outPath := filepath.Join(flag.Arg(1), projects[i], *outputName)
-			changes, err := contempt.Generate(*sourceLink, flag.Arg(0), filepath.Join(projects[i], *templateName), outPath)
+
+			var err error
+			tags, err = imageTags(templates, tagData{
+				Project: p.Name,
+				Date:    report.Started.UTC().Format("20060102"),
+				commit:  r.Commit,
+			}, result.Materials)
 			if err != nil {
-				log.Fatalf("Failed to generate project %s: %v", projects[i], err)
+				r.fail("Failed to determine tags for %s: %v", p.Name, err)
+				return projectFailed
 			}
+		}
 
-			if *commit {
-				if err := doCommit(projects[i], changes); err != nil {
-					log.Printf("Failed to commit %s: %v", projects[i], err)
-					continue
-				}
+		// Images are exported to a layout so that contempt can push them itself.
+		var layout string
+		if *push {
+			var err error
+			layout, err = os.MkdirTemp("", "contempt-layout")
+			if err != nil {
+				r.fail("Failed to create layout directory for %s: %v", p.Name, err)
+				return projectFailed
+			}
+			defer os.RemoveAll(layout)
+		}
+
+		if err := r.timed("build", func() error {
+			return imageBuilder.Build(r.output, buildOptions{
+				Context:      outDir,
+				File:         filepath.Join(outDir, *outputName),
+				Tag:          imageName,
+				Reproducible: true,
+				BuildArgs:    imageBuildArgs,
+				Platforms:    imagePlatforms,
+				Layout:       layout,
+			})
+		}); err != nil {
+			r.Build = stepFailed
+			r.fail("Failed to build %s: %v", p.Name, err)
+			return projectFailed
+		}
+		r.Build = stepSucceeded
+
+		if *push {
+			if err := r.timed("push", func() (err error) {
+				r.Digest, err = pushLayout(r, layout, imageName)
+				return err
+			}); err != nil {
+				r.Push = stepFailed
+				r.fail("Failed to push %s: %v", p.Name, err)
+				return projectFailed
 			}
 
-			if (*commit && *build) || *forceBuild {
-				imageName := fmt.Sprintf("%s/%s", sources.Registry(), projects[i])
-				if err := runBuildahCommand(
-					"bud",
-					"--timestamp",
-					"0",
-					"--layers",
-					"--tag",
-					imageName,
-					filepath.Join(flag.Arg(1), projects[i]),
-				); err != nil {
-					log.Fatalf("Failed to build %s: %v", projects[i], err)
+			if len(tags) > 0 {
+				if err := r.timed("tag", func() error {
+					return sources.TagImage(imageName, r.Digest, tags...)
+				}); err != nil {
+					r.Push = stepFailed
+					r.fail("Failed to tag %s: %v", p.Name, err)
+					return projectFailed
 				}
+				r.Tags = tags
+			}
+			r.Push = stepSucceeded
 
-				if *push {
-					success := false
-					for r := 0; r <= *pushRetries && !success; r++ {
-						if err := runBuildahCommand("push", imageName); err == nil {
-							success = true
-						} else {
-							log.Printf("Failed to push %s [attempt %d/%d]: %v", projects[i], r+1, *pushRetries+1, err)
-						}
-					}
-					if !success {
-						log.Fatalf("Failed to push %s after %d attempts", projects[i], *pushRetries+1)
-					}
+			copyToMirrors(r, p.Name, imageName, tags)
+
+			if len(imagePlatforms) > 1 {
+				if digests, err := sources.PlatformDigests(fmt.Sprintf("%s@%s", imageName, r.Digest)); err == nil {
+					r.Platforms = digests
+				} else {
+					r.logf("Unable to get platform digests for %s: %v", p.Name, err)
 				}
 			}
-			if *workflowCommands {
-				fmt.Printf("::endgroup::\n")
+		}
+	}
+
+	return projectSucceeded
+}
+
+// checkProject prints a diff of any rendered files that differ from those in the output directory.
+func checkProject(r *projectReport, result *contempt.Result) projectOutcome {
+	for i := range result.Files {
+		if result.Files[i].Changed() {
+			oldName := "/dev/null"
+			if result.Files[i].Existed {
+				oldName = path.Join("a", r.Name, result.Files[i].Name)
 			}
+
+			_, _ = fmt.Fprint(r.output, internal.UnifiedDiff(
+				oldName,
+				path.Join("b", r.Name, result.Files[i].Name),
+				string(result.Files[i].Previous),
+				string(result.Files[i].Content),
+			))
 		}
 	}
+
+	if result.Changed() {
+		r.logf("Project %s is out of date", r.Name)
+		return projectRefused
+	}
+	return projectSucceeded
 }
 
-func doCommit(project string, changes []contempt.Change) error {
-	if err := runGitCommand(
+// gitMutex prevents projects being committed concurrently, as they share the same git repository.
+var gitMutex sync.Mutex
+
+func doCommit(r *projectReport, project string, names []string, changes []contempt.Change) error {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+
+	var files []string
+	for i := range names {
+		files = append(files, filepath.Join(filepath.FromSlash(project), names[i]))
+	}
+
+	if err := runGitCommand(r.output, append([]string{
 		"-C",
-		flag.Arg(1),
+		outputDir,
 		"add",
-		filepath.Join(project, *outputName),
-	); err != nil {
+	}, files...)...); err != nil {
 		return err
 	}
 
-	if err := runGitCommand(
+	if err := runGitCommand(r.output, append([]string{
 		"-C",
-		flag.Arg(1),
+		outputDir,
 		"commit",
 		"--no-gpg-sign",
 		"-m",
-		fmt.Sprintf("[%s] %s", project, formatChanges(changes)),
-		filepath.Join(project, *outputName),
-	); err != nil {
+		commitMessage(project, changes),
+	}, files...)...); err != nil {
 		return err
 	}
+
+	if sha, err := gitOutput("-C", outputDir, "rev-parse", "HEAD"); err == nil {
+		r.Commit = sha
+	}
 	return nil
 }
 
-func runGitCommand(args ...string) error {
-	return runCommand(exec.Command(
+func runGitCommand(out io.Writer, args ...string) error {
+	return runCommand(out, exec.Command(
 		"git",
 		args...,
 	))
 }
 
-func runBuildahCommand(args ...string) error {
-	return runCommand(exec.Command(
-		"/usr/bin/buildah",
-		args...,
-	))
+// sbomsExist determines whether all the SBOM files have already been written to the given directory.
+func sbomsExist(outDir string) bool {
+	for _, name := range []string{contempt.CycloneDXName, contempt.SPDXName} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
-func runCommand(cmd *exec.Cmd) error {
-	log.Printf("Running \"%s\"", strings.Join(cmd.Args, "\" \""))
-	cmd.Stdout = os.Stdout
+// gitOutput runs git with the given arguments, returning its trimmed output.
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
 	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// runCommand runs the given command, writing its output and error streams to out.
+func runCommand(out io.Writer, cmd *exec.Cmd) error {
+	log.New(out, "", log.LstdFlags).Printf("Running \"%s\"", strings.Join(cmd.Args, "\" \""))
+	cmd.Stdout = out
+	cmd.Stderr = out
 	return cmd.Run()
 }
 
 func checkExternalDependencies() {
-	if *build || *forceBuild {
-		if err := runBuildahCommand("--version"); err != nil {
-			log.Fatalf("Contempt is configured to build, but buildah doesn't seem to be working: %v", err)
+	if *check {
+		// Nothing is committed or built when checking.
+		return
+	}
+
+	if *build || *forceBuild || *auditRegenerate {
+		if err := imageBuilder.Check(os.Stdout); err != nil {
+			fatalf(nil, "Contempt is configured to build, but %s doesn't seem to be working: %v", *builderName, err)
+		}
+	}
+
+	if *push {
+		for i := range pushTargets {
+			if _, err := pushTargets[i].credentials(); err != nil {
+				fatalf(nil, "Contempt is configured to copy images to other registries, but %v", err)
+			}
 		}
 	}
 
 	if *commit {
-		if err := runGitCommand("--version"); err != nil {
-			log.Fatalf("Contempt is configured to commit, but git doesn't seem to be working: %v", err)
+		if err := runGitCommand(os.Stdout, "--version"); err != nil {
+			fatalf(nil, "Contempt is configured to commit, but git doesn't seem to be working: %v", err)
 		}
 	}
 }
@@ -173,7 +520,23 @@ func formatChanges(changes []contempt.Change) string {
 	builder := strings.Builder{}
 
 	if len(changes) > 1 {
-		builder.WriteString(fmt.Sprintf("%d changes\n", len(changes)))
+		builder.WriteString(fmt.Sprintf("%d changes", len(changes)))
+
+		counts := make(map[contempt.ChangeKind]int)
+		for i := range changes {
+			counts[changes[i].Kind]++
+		}
+
+		var summary []string
+		for _, kind := range []contempt.ChangeKind{contempt.Added, contempt.Removed, contempt.Downgraded} {
+			if counts[kind] > 0 {
+				summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
+			}
+		}
+		if len(summary) > 0 {
+			builder.WriteString(fmt.Sprintf(" (%s)", strings.Join(summary, ", ")))
+		}
+		builder.WriteString("\n")
 
 		sort.Slice(changes, func(i, j int) bool {
 			return changes[i].Material < changes[j].Material
@@ -181,18 +544,37 @@ func formatChanges(changes []contempt.Change) string {
 	}
 
 	for i := range changes {
-		oldVersion := changes[i].Old
-		newVersion := changes[i].New
-		if oldVersion == "" && newVersion == "" {
-			builder.WriteString(fmt.Sprintf("\n%s unknown changes", changes[i].Material))
-		} else if oldVersion == "" {
-			builder.WriteString(fmt.Sprintf("\n%s (unknown)->%.8s", changes[i].Material, newVersion))
-		} else if newVersion == "" {
-			builder.WriteString(fmt.Sprintf("\n%s %.8s->(unknown)", changes[i].Material, oldVersion))
-		} else {
+		oldVersion := changes[i].OldVersion()
+		newVersion := changes[i].NewVersion()
+		switch {
+		case changes[i].Kind == contempt.Added:
+			builder.WriteString(fmt.Sprintf("\n%s added %.12s", changes[i].Material, newVersion))
+		case changes[i].Kind == contempt.Removed:
+			builder.WriteString(fmt.Sprintf("\n%s removed (was %.12s)", changes[i].Material, oldVersion))
+		case oldVersion == newVersion:
+			// The version is the same but the digest has changed (e.g. a tag has been moved), so show the digests.
+			builder.WriteString(fmt.Sprintf(
+				"\n%s %s (%.12s)->%s (%.12s)",
+				changes[i].Material,
+				oldVersion,
+				digestHash(changes[i].Old.Digest),
+				newVersion,
+				digestHash(changes[i].New.Digest),
+			))
+		case changes[i].Kind == contempt.Downgraded:
+			builder.WriteString(fmt.Sprintf("\n%s %.12s->%.12s (downgrade)", changes[i].Material, oldVersion, newVersion))
+		default:
 			builder.WriteString(fmt.Sprintf("\n%s %.12s->%.12s", changes[i].Material, oldVersion, newVersion))
 		}
 	}
 
 	return strings.TrimPrefix(builder.String(), "\n")
 }
+
+// digestHash strips the algorithm prefix from a digest, e.g. "sha256:abc" -> "abc".
+func digestHash(digest string) string {
+	if _, hash, found := strings.Cut(digest, ":"); found {
+		return hash
+	}
+	return digest
+}
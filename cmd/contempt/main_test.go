@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_formatChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []contempt.Change
+		want    string
+	}{
+		{
+			"No changes",
+			nil,
+			"no detected changes",
+		},
+		{
+			"Single upgrade",
+			[]contempt.Change{
+				{Material: "apk:musl", Kind: contempt.Upgraded, Old: &contempt.Material{Version: "1.2.3"}, New: &contempt.Material{Version: "1.2.4"}},
+			},
+			"apk:musl 1.2.3->1.2.4",
+		},
+		{
+			"Truncates image digests",
+			[]contempt.Change{
+				{Material: "image:alpine", Kind: contempt.Changed, Old: &contempt.Material{Version: "0123456789abcdef"}, New: &contempt.Material{Version: "fedcba9876543210"}},
+			},
+			"image:alpine 0123456789ab->fedcba987654",
+		},
+		{
+			"Moved tag",
+			[]contempt.Change{
+				{
+					Material: "github:csmith/contempt",
+					Kind:     contempt.Changed,
+					Old:      &contempt.Material{Version: "v1.0.0", Digest: "sha1:0123456789abcdef"},
+					New:      &contempt.Material{Version: "v1.0.0", Digest: "sha1:fedcba9876543210"},
+				},
+			},
+			"github:csmith/contempt v1.0.0 (0123456789ab)->v1.0.0 (fedcba987654)",
+		},
+		{
+			"Multiple changes of different kinds",
+			[]contempt.Change{
+				{Material: "apk:new", Kind: contempt.Added, New: &contempt.Material{Version: "1.0.0"}},
+				{Material: "apk:gone", Kind: contempt.Removed, Old: &contempt.Material{Version: "2.0.0"}},
+				{Material: "apk:older", Kind: contempt.Downgraded, Old: &contempt.Material{Version: "1.1"}, New: &contempt.Material{Version: "1.0"}},
+				{Material: "apk:newer", Kind: contempt.Upgraded, Old: &contempt.Material{Version: "1.0"}, New: &contempt.Material{Version: "1.1"}},
+			},
+			"4 changes (1 added, 1 removed, 1 downgraded)\n\napk:gone removed (was 2.0.0)\napk:new added 1.0.0\napk:newer 1.0->1.1\napk:older 1.1->1.0 (downgrade)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatChanges(tt.changes))
+		})
+	}
+}
+
+func Test_runError(t *testing.T) {
+	oldCheck := *check
+	defer func() { *check = oldCheck }()
+
+	tests := []struct {
+		name                                string
+		check                               bool
+		failed, partial, violating, refused []string
+		want                                string
+	}{
+		{"Success", false, nil, nil, nil, nil, ""},
+		{"Failures take precedence", false, []string{"a"}, []string{"b"}, []string{"c"}, []string{"d"}, "1 project(s) failed: a"},
+		{"Partial copies", false, nil, []string{"b", "c"}, nil, nil, "2 project(s) couldn't be copied to every registry: b, c"},
+		{"Refused changes", false, nil, nil, nil, []string{"d"}, "One or more projects were not updated due to unapproved changes"},
+		{"Out of date", true, nil, nil, nil, []string{"d"}, "One or more projects are out of date"},
+		{"Policy violations", true, nil, nil, []string{"c"}, nil, "1 project(s) violate the policy: c"},
+		{
+			"Policy violations and out of date projects",
+			true, nil, nil, []string{"c"}, []string{"d"},
+			"1 project(s) violate the policy: c. One or more projects are out of date",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*check = tt.check
+			assert.Equal(t, tt.want, runError(tt.failed, tt.partial, tt.violating, tt.refused))
+		})
+	}
+}
+
+func Test_processProject_policyViolationWhenChecking(t *testing.T) {
+	oldCheck, oldWorkers, oldInputDir, oldOutputDir := *check, *workers, inputDir, outputDir
+	defer func() { *check, *workers, inputDir, outputDir = oldCheck, oldWorkers, oldInputDir, oldOutputDir }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "version=1.2.3")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("deny:\n  - materials: [\"regexurl:*\"]\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "Dockerfile.gotpl"), []byte(`FROM scratch
+ENV VERSION={{regex_url_content "app" .url "version=([0-9.]+)"}}`), 0600))
+
+	*check, *workers, inputDir, outputDir = true, 1, dir, filepath.Join(dir, "out")
+
+	project := contempt.Project{
+		Name:     "app",
+		Template: filepath.Join("app", "Dockerfile.gotpl"),
+		Values:   map[string]interface{}{"url": server.URL},
+	}
+	r := newProjectReport(project.Name)
+	assert.Equal(t, projectViolatesPolicy, processProject(project, "", r, false))
+	assert.Equal(t, []contempt.Violation{{Material: "regexurl:app"}}, r.Violations)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/csmith/contempt/sources"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+var pushTo = flag.String("push-to", "", "A comma-separated list of extra registries to copy pushed images to, e.g. ghcr.io/example;credentials=GHCR;flatten")
+
+// pushTargets are the extra registries given by the -push-to flag.
+var pushTargets []pushTarget
+
+// pushTarget is an extra registry that pushed images are copied to.
+type pushTarget struct {
+	// Repository is the registry, and optionally a namespace within it, that images are copied to.
+	Repository string
+	// Prefix is prepended to the name of each image.
+	Prefix string
+	// Flatten replaces slashes in project names with dashes, for registries that don't support nested names.
+	Flatten bool
+	// Credentials is the prefix of the environment variables that hold the credentials for the registry
+	// (<Credentials>_USER and <Credentials>_PASS). If empty, credentials are read from the default keychain.
+	Credentials string
+}
+
+// parsePushTargets parses a comma-separated list of targets. Each target is a repository, followed by any number of
+// semicolon-separated options: "flatten", "prefix=<prefix>" or "credentials=<env var prefix>".
+func parsePushTargets(value string) ([]pushTarget, error) {
+	var res []pushTarget
+	for _, spec := range splitList(value) {
+		parts := strings.Split(spec, ";")
+		target := pushTarget{Repository: strings.TrimSuffix(strings.TrimSpace(parts[0]), "/")}
+
+		for _, option := range parts[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(option), "=")
+			switch key {
+			case "flatten":
+				target.Flatten = true
+			case "prefix":
+				target.Prefix = val
+			case "credentials":
+				target.Credentials = val
+			default:
+				return nil, fmt.Errorf("unknown option %q for registry %s", option, target.Repository)
+			}
+		}
+
+		if _, err := name.NewRepository(target.image("example")); err != nil {
+			return nil, fmt.Errorf("invalid registry %s: %v", target.Repository, err)
+		}
+		res = append(res, target)
+	}
+	return res, nil
+}
+
+// image returns the name of the given project's image in the target registry.
+func (t pushTarget) image(project string) string {
+	if t.Flatten {
+		project = strings.ReplaceAll(project, "/", "-")
+	}
+	return path.Join(t.Repository, t.Prefix+project)
+}
+
+// credentials returns the credentials to use for the target registry.
+func (t pushTarget) credentials() (sources.Credentials, error) {
+	if t.Credentials == "" {
+		return sources.Credentials{}, nil
+	}
+
+	creds := sources.Credentials{
+		Username: os.Getenv(t.Credentials + "_USER"),
+		Password: os.Getenv(t.Credentials + "_PASS"),
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return creds, fmt.Errorf("credentials for %s not found: %s_USER and %s_PASS must be set", t.Repository, t.Credentials, t.Credentials)
+	}
+	return creds, nil
+}
+
+// copyToMirrors copies the project's pushed image, along with its tags, to each of the extra registries. The outcome
+// for each registry is recorded in the report; failures don't stop the image being copied to the others.
+func copyToMirrors(r *projectReport, project, image string, tags []string) {
+	var failed []string
+	for _, target := range pushTargets {
+		m := &mirrorReport{Registry: target.Repository, Image: target.image(project), Status: stepSucceeded}
+		r.Mirrors = append(r.Mirrors, m)
+
+		creds, err := target.credentials()
+		if err == nil {
+			err = withRetries(r, fmt.Sprintf("copy %s to %s", image, m.Image), func() error {
+				return sources.CopyImage(image, r.Digest, m.Image, creds, tags...)
+			})
+		}
+
+		if err != nil {
+			m.Status = stepFailed
+			m.Error = err.Error()
+			failed = append(failed, target.Repository)
+		} else {
+			r.logf("Copied %s to %s", image, m.Image)
+		}
+	}
+
+	if len(failed) > 0 {
+		r.fail("Failed to copy %s to %d of %d registries: %s", project, len(failed), len(pushTargets), strings.Join(failed, ", "))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/csmith/contempt/sources"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsePushTargets(t *testing.T) {
+	targets, err := parsePushTargets("reg.example.com, ghcr.io/example/;flatten;prefix=c-;credentials=GHCR")
+	require.NoError(t, err)
+	assert.Equal(t, []pushTarget{
+		{Repository: "reg.example.com"},
+		{Repository: "ghcr.io/example", Prefix: "c-", Flatten: true, Credentials: "GHCR"},
+	}, targets)
+
+	assert.Equal(t, "reg.example.com/tools/web", targets[0].image("tools/web"))
+	assert.Equal(t, "ghcr.io/example/c-tools-web", targets[1].image("tools/web"))
+
+	targets, err = parsePushTargets("")
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	_, err = parsePushTargets("ghcr.io/example;mirror")
+	assert.ErrorContains(t, err, "unknown option")
+
+	_, err = parsePushTargets("https://ghcr.io/Example")
+	assert.ErrorContains(t, err, "invalid registry")
+}
+
+func Test_pushTarget_credentials(t *testing.T) {
+	creds, err := pushTarget{Repository: "reg.example.com"}.credentials()
+	require.NoError(t, err)
+	assert.Equal(t, sources.Credentials{}, creds)
+
+	target := pushTarget{Repository: "ghcr.io/example", Credentials: "CONTEMPT_TEST_GHCR"}
+	_, err = target.credentials()
+	assert.ErrorContains(t, err, "CONTEMPT_TEST_GHCR_USER and CONTEMPT_TEST_GHCR_PASS must be set")
+
+	t.Setenv("CONTEMPT_TEST_GHCR_USER", "user")
+	t.Setenv("CONTEMPT_TEST_GHCR_PASS", "pass")
+	creds, err = target.credentials()
+	require.NoError(t, err)
+	assert.Equal(t, sources.Credentials{Username: "user", Password: "pass"}, creds)
+}
+
+func Test_copyToMirrors_reportsEachRegistry(t *testing.T) {
+	primary := httptest.NewServer(registry.New())
+	defer primary.Close()
+	mirror := httptest.NewServer(registry.New())
+	defer mirror.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer broken.Close()
+
+	host := func(s *httptest.Server) string {
+		return strings.TrimPrefix(s.URL, "http://")
+	}
+
+	image, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendImage(image))
+
+	r := &projectReport{logger: log.New(io.Discard, "", 0)}
+	r.Digest, err = sources.PushLayout(string(p), host(primary)+"/tools/web")
+	require.NoError(t, err)
+
+	oldTargets, oldRetries := pushTargets, *pushRetries
+	pushTargets = []pushTarget{
+		{Repository: host(mirror) + "/mirror", Flatten: true},
+		{Repository: host(broken)},
+		{Repository: "ghcr.io/example", Credentials: "CONTEMPT_TEST_MISSING"},
+	}
+	*pushRetries = 0
+	defer func() {
+		pushTargets, *pushRetries = oldTargets, oldRetries
+	}()
+
+	copyToMirrors(r, "tools/web", host(primary)+"/tools/web", []string{"1.2"})
+
+	require.Len(t, r.Mirrors, 3)
+	assert.Equal(t, stepSucceeded, r.Mirrors[0].Status)
+	assert.Equal(t, host(mirror)+"/mirror/tools-web", r.Mirrors[0].Image)
+	assert.Equal(t, stepFailed, r.Mirrors[1].Status)
+	assert.NotEmpty(t, r.Mirrors[1].Error)
+	assert.Equal(t, stepFailed, r.Mirrors[2].Status)
+	assert.Contains(t, r.Mirrors[2].Error, "CONTEMPT_TEST_MISSING_USER")
+	assert.Equal(t, 2, r.mirrorsFailed())
+	assert.Contains(t, r.Error, "2 of 3 registries")
+
+	copied, err := crane.Digest(host(mirror) + "/mirror/tools-web:1.2")
+	require.NoError(t, err)
+	assert.Equal(t, r.Digest, copied)
+}
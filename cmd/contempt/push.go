@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/csmith/contempt/sources"
+)
+
+var pushBackoff = flag.Duration("push-backoff", 5*time.Second, "How long to wait before retrying a failed push. The delay doubles with each retry, with some random jitter")
+
+// maxPushBackoff caps the delay between push attempts.
+const maxPushBackoff = 5 * time.Minute
+
+// sleep waits for the given duration. It is replaced in tests.
+var sleep = time.Sleep
+
+// pushLayout pushes the image in the given OCI layout, retrying with exponential backoff if it fails. Blobs uploaded
+// by a failed attempt aren't uploaded again. Returns the digest of the pushed image.
+func pushLayout(r *projectReport, layout, image string) (digest string, err error) {
+	err = withRetries(r, fmt.Sprintf("push %s", image), func() (err error) {
+		digest, err = sources.PushLayout(layout, image)
+		return err
+	})
+	return digest, err
+}
+
+// withRetries calls f until it succeeds, up to the number of times allowed by -push-retries, waiting with
+// exponential backoff between attempts. The action describes what f does, for logging.
+func withRetries(r *projectReport, action string, f func() error) error {
+	var err error
+	for attempt := 0; attempt <= *pushRetries; attempt++ {
+		if attempt > 0 {
+			delay := backoffDelay(*pushBackoff, attempt-1, rand.Float64())
+			r.logf("Retrying in %s", delay.Round(time.Millisecond))
+			sleep(delay)
+		}
+
+		if err = f(); err == nil {
+			return nil
+		}
+		r.logf("Failed to %s [attempt %d/%d]: %v", action, attempt+1, *pushRetries+1, err)
+	}
+	return fmt.Errorf("failed after %d attempts: %v", *pushRetries+1, err)
+}
+
+// backoffDelay returns how long to wait before the given retry (counting from zero). The initial delay is doubled
+// for each retry up to maxPushBackoff, then scaled by a factor between 0.5 and 1.5 based on random (which should be
+// in the range [0, 1)), so that concurrent pushes don't all retry at the same time.
+func backoffDelay(initial time.Duration, retry int, random float64) time.Duration {
+	delay := initial
+	for i := 0; i < retry && delay < maxPushBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxPushBackoff {
+		delay = maxPushBackoff
+	}
+	return time.Duration(float64(delay) * (0.5 + random))
+}
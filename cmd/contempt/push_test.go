@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_backoffDelay(t *testing.T) {
+	assert.Equal(t, 5*time.Second, backoffDelay(5*time.Second, 0, 0.5))
+	assert.Equal(t, 10*time.Second, backoffDelay(5*time.Second, 1, 0.5))
+	assert.Equal(t, 20*time.Second, backoffDelay(5*time.Second, 2, 0.5))
+	assert.Equal(t, 10*time.Second, backoffDelay(5*time.Second, 2, 0))
+	assert.Equal(t, maxPushBackoff, backoffDelay(5*time.Second, 20, 0.5))
+	assert.Equal(t, maxPushBackoff*3/2, backoffDelay(5*time.Second, 100, 1))
+}
+
+func Test_pushLayout_retriesWithoutReuploading(t *testing.T) {
+	var manifestPuts, blobUploads int32
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+			if atomic.AddInt32(&manifestPuts, 1) == 1 {
+				http.Error(w, "nope", http.StatusBadRequest)
+				return
+			}
+		} else if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/blobs/uploads/") {
+			atomic.AddInt32(&blobUploads, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	image, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendImage(image))
+
+	var delays []time.Duration
+	oldSleep, oldRetries, oldBackoff := sleep, *pushRetries, *pushBackoff
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	*pushRetries = 2
+	*pushBackoff = time.Second
+	defer func() {
+		sleep, *pushRetries, *pushBackoff = oldSleep, oldRetries, oldBackoff
+	}()
+
+	r := &projectReport{logger: log.New(io.Discard, "", 0)}
+	digest, err := pushLayout(r, string(p), strings.TrimPrefix(server.URL, "http://")+"/tools/web")
+	require.NoError(t, err)
+
+	expected, err := image.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), digest)
+	assert.Equal(t, int32(2), manifestPuts)
+	// Two layers and the config, each uploaded once.
+	assert.Equal(t, int32(3), blobUploads)
+	require.Len(t, delays, 1)
+	assert.GreaterOrEqual(t, delays[0], 500*time.Millisecond)
+	assert.Less(t, delays[0], 1500*time.Millisecond)
+}
+
+func Test_pushLayout_givesUp(t *testing.T) {
+	oldSleep, oldRetries := sleep, *pushRetries
+	sleep = func(time.Duration) {}
+	*pushRetries = 1
+	defer func() {
+		sleep, *pushRetries = oldSleep, oldRetries
+	}()
+
+	r := &projectReport{logger: log.New(io.Discard, "", 0)}
+	_, err := pushLayout(r, t.TempDir(), "localhost:1/tools/web")
+	assert.ErrorContains(t, err, "failed after 2 attempts")
+}
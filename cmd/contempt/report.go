@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/csmith/contempt"
+)
+
+var reportPath = flag.String("report", "", "Path to write a JSON report of the run to")
+
+// stepStatus describes the outcome of a single step (such as building or pushing) for a project.
+type stepStatus string
+
+const (
+	stepSkipped   stepStatus = "skipped"
+	stepSucceeded stepStatus = "succeeded"
+	stepFailed    stepStatus = "failed"
+)
+
+// runReport is the machine-readable report written when the -report flag is used.
+type runReport struct {
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Success  bool             `json:"success"`
+	Error    string           `json:"error,omitempty"`
+	Projects []*projectReport `json:"projects"`
+}
+
+// projectReport describes what happened to a single project during the run.
+type projectReport struct {
+	Name       string               `json:"name"`
+	Changed    bool                 `json:"changed"`
+	Changes    []contempt.Change    `json:"changes"`
+	Advisories []contempt.Finding   `json:"advisories,omitempty"`
+	Violations []contempt.Violation `json:"violations,omitempty"`
+	Commit     string               `json:"commit,omitempty"`
+	Build      stepStatus           `json:"build"`
+	Push       stepStatus           `json:"push"`
+	Image      string               `json:"image,omitempty"`
+	Digest     string               `json:"digest,omitempty"`
+	Platforms  map[string]string    `json:"platforms,omitempty"`
+	Tags       []string             `json:"tags,omitempty"`
+	Mirrors    []*mirrorReport      `json:"mirrors,omitempty"`
+	Timings    map[string]float64   `json:"timings"`
+	Error      string               `json:"error,omitempty"`
+
+	// output receives the project's logs and the output of any commands run for it.
+	output io.Writer
+	// buffer holds the project's output until it has finished, if projects are being processed concurrently.
+	buffer *bytes.Buffer
+	logger *log.Logger
+}
+
+// mirrorReport describes the outcome of copying a project's image to one of the extra registries.
+type mirrorReport struct {
+	Registry string     `json:"registry"`
+	Image    string     `json:"image"`
+	Status   stepStatus `json:"status"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// mirrorsFailed returns the number of extra registries the project's image couldn't be copied to.
+func (p *projectReport) mirrorsFailed() int {
+	count := 0
+	for i := range p.Mirrors {
+		if p.Mirrors[i].Status == stepFailed {
+			count++
+		}
+	}
+	return count
+}
+
+// reportMutex guards the run report, as projects may be processed concurrently.
+var reportMutex sync.Mutex
+
+var report = &runReport{
+	Started:  time.Now(),
+	Success:  true,
+	Projects: []*projectReport{},
+}
+
+// newProjectReport creates a report for the given project and adds it to the run report.
+func newProjectReport(name string) *projectReport {
+	p := &projectReport{
+		Name:    name,
+		Changes: []contempt.Change{},
+		Build:   stepSkipped,
+		Push:    stepSkipped,
+		Timings: make(map[string]float64),
+		output:  stdout,
+		logger:  log.Default(),
+	}
+
+	if *workers > 1 {
+		p.buffer = &bytes.Buffer{}
+		p.output = p.buffer
+		p.logger = log.New(p.buffer, "", log.LstdFlags)
+	}
+
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	report.Projects = append(report.Projects, p)
+	return p
+}
+
+// logf logs a message to the project's output.
+func (p *projectReport) logf(format string, args ...interface{}) {
+	p.logger.Printf(format, args...)
+}
+
+// stdout is where project output is written, once it has been flushed if buffered.
+var stdout io.Writer = os.Stdout
+
+// outputMutex prevents the buffered output of different projects being interleaved.
+var outputMutex sync.Mutex
+
+// flush prints the project's buffered output, wrapped in a group if workflow commands are enabled.
+func (p *projectReport) flush() {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	if *workflowCommands {
+		_, _ = fmt.Fprintf(stdout, "::group::%s\n", p.Name)
+		defer fmt.Fprintf(stdout, "::endgroup::\n")
+	}
+	_, _ = stdout.Write(p.buffer.Bytes())
+}
+
+// timed runs the given function, recording how long it took (in seconds) against the named step.
+func (p *projectReport) timed(step string, f func() error) error {
+	start := time.Now()
+	err := f()
+	p.Timings[step] = time.Since(start).Seconds()
+	return err
+}
+
+// fail records a non-fatal error for the project.
+func (p *projectReport) fail(format string, args ...interface{}) {
+	p.Error = fmt.Sprintf(format, args...)
+	p.logf("%s", p.Error)
+
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	report.Success = false
+}
+
+// fatalf records an error against the given project (if any), writes the report, and then exits.
+func fatalf(p *projectReport, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if p != nil {
+		p.Error = message
+	} else {
+		report.Error = message
+	}
+	report.Success = false
+	writeReport()
+	writeSummary()
+	log.Fatal(message)
+}
+
+// writeReport writes the run report to the path given by the -report flag, if any.
+func writeReport() {
+	if *reportPath == "" {
+		return
+	}
+
+	report.Finished = time.Now()
+	bs, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal report: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(*reportPath, bs, os.FileMode(0644)); err != nil {
+		log.Printf("Failed to write report to %s: %v", *reportPath, err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/csmith/contempt"
+)
+
+var workers = flag.Int("workers", 1, "How many projects to process concurrently. Output is buffered and printed when each project finishes if more than one")
+
+// scheduledResult is the outcome of a single project that was processed by the scheduler.
+type scheduledResult struct {
+	name    string
+	outcome projectOutcome
+	pushed  bool
+}
+
+// schedule processes the given projects (which must be ordered so that dependencies come before their dependents)
+// using up to the given number of workers. Each project is started as soon as all of its dependencies have finished.
+//
+// Once a project's dependencies have finished, wanted is called to decide whether to process it, given whether any
+// of its dependencies pushed an image. If so, run is called on a new goroutine, and should return the project's
+// outcome and whether it pushed an image. If any of its dependencies failed, a wanted project is cancelled instead.
+// Both wanted and cancel are called from the calling goroutine. When only one worker is used, projects are processed
+// in the order they are given.
+//
+// The results of every project are returned in the same order as the projects. Projects that weren't wanted are
+// reported as succeeding, and projects that were cancelled as failing.
+func schedule(
+	projects []contempt.Project,
+	workers int,
+	wanted func(p contempt.Project, dependenciesPushed bool) bool,
+	run func(p contempt.Project) (projectOutcome, bool),
+	cancel func(p contempt.Project, dependency string),
+) []*scheduledResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	index := make(map[string]int, len(projects))
+	for i := range projects {
+		index[projects[i].Name] = i
+	}
+
+	pending := make([]int, len(projects))
+	dependents := make([][]int, len(projects))
+	for i := range projects {
+		for _, dep := range projects[i].Dependencies {
+			if j, ok := index[dep]; ok {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	var ready []int
+	for i := range projects {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	results := make([]*scheduledResult, len(projects))
+	finished := 0
+	finish := func(i int, result *scheduledResult) {
+		results[i] = result
+		finished++
+		for _, dependent := range dependents[i] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				// Keep the ready queue in the original order, so that a single worker processes projects in order.
+				pos := len(ready)
+				for pos > 0 && ready[pos-1] > dependent {
+					pos--
+				}
+				ready = append(ready[:pos], append([]int{dependent}, ready[pos:]...)...)
+			}
+		}
+	}
+
+	type completion struct {
+		index  int
+		result *scheduledResult
+	}
+
+	completed := make(chan completion)
+	running := 0
+	for finished < len(projects) {
+		for len(ready) > 0 && running < workers {
+			i := ready[0]
+			ready = ready[1:]
+
+			failedDependency, dependenciesPushed := "", false
+			for _, dep := range projects[i].Dependencies {
+				if j, ok := index[dep]; ok {
+					if results[j].outcome == projectFailed && failedDependency == "" {
+						failedDependency = dep
+					}
+					dependenciesPushed = dependenciesPushed || results[j].pushed
+				}
+			}
+
+			if !wanted(projects[i], dependenciesPushed) {
+				finish(i, &scheduledResult{name: projects[i].Name})
+			} else if failedDependency != "" {
+				cancel(projects[i], failedDependency)
+				finish(i, &scheduledResult{name: projects[i].Name, outcome: projectFailed})
+			} else {
+				running++
+				go func(i int) {
+					outcome, pushed := run(projects[i])
+					completed <- completion{i, &scheduledResult{name: projects[i].Name, outcome: outcome, pushed: pushed}}
+				}(i)
+			}
+		}
+
+		if running == 0 {
+			// Nothing is running and nothing is ready; this can only happen if there's a dependency cycle.
+			for i := range results {
+				if results[i] == nil {
+					results[i] = &scheduledResult{name: projects[i].Name, outcome: projectFailed}
+				}
+			}
+			break
+		}
+
+		c := <-completed
+		running--
+		finish(c.index, c.result)
+	}
+
+	return results
+}
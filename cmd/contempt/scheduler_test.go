@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+)
+
+var schedulerProjects = []contempt.Project{
+	{Name: "base"},
+	{Name: "slow"},
+	{Name: "tools", Dependencies: []string{"base"}},
+	{Name: "app", Dependencies: []string{"tools", "slow"}},
+	{Name: "other", Dependencies: []string{"base"}},
+}
+
+func outcomes(results []*scheduledResult) map[string]projectOutcome {
+	res := make(map[string]projectOutcome)
+	for i := range results {
+		res[results[i].name] = results[i].outcome
+	}
+	return res
+}
+
+func Test_schedule_singleWorkerPreservesOrder(t *testing.T) {
+	var order []string
+	results := schedule(schedulerProjects, 1, func(contempt.Project, bool) bool {
+		return true
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		order = append(order, p.Name)
+		return projectSucceeded, false
+	}, func(contempt.Project, string) {
+		t.Fatal("unexpected cancellation")
+	})
+
+	assert.Equal(t, []string{"base", "slow", "tools", "app", "other"}, order)
+	assert.Len(t, results, 5)
+}
+
+func Test_schedule_startsProjectsWhenDependenciesFinish(t *testing.T) {
+	var mutex sync.Mutex
+	var order []string
+	finished := make(map[string]bool)
+	release := make(chan struct{})
+
+	schedule(schedulerProjects, 3, func(contempt.Project, bool) bool {
+		return true
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		mutex.Lock()
+		for _, dep := range p.Dependencies {
+			assert.True(t, finished[dep], "%s started before its dependency %s finished", p.Name, dep)
+		}
+		mutex.Unlock()
+
+		if p.Name == "slow" {
+			<-release
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		order = append(order, p.Name)
+		finished[p.Name] = true
+		if p.Name == "other" {
+			// Everything that doesn't depend on the slow project has now finished.
+			close(release)
+		}
+		return projectSucceeded, false
+	}, func(contempt.Project, string) {
+		t.Fatal("unexpected cancellation")
+	})
+
+	assert.Equal(t, "app", order[len(order)-1])
+	assert.Less(t, indexOf(order, "other"), indexOf(order, "slow"))
+}
+
+func indexOf(values []string, value string) int {
+	for i := range values {
+		if values[i] == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func Test_schedule_cancelsDependentsOfFailedProjects(t *testing.T) {
+	var mutex sync.Mutex
+	var ran []string
+	cancelled := make(map[string]string)
+
+	results := schedule(schedulerProjects, 2, func(contempt.Project, bool) bool {
+		return true
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		mutex.Lock()
+		ran = append(ran, p.Name)
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond)
+		if p.Name == "tools" {
+			return projectFailed, false
+		}
+		if p.Name == "other" {
+			return projectRefused, false
+		}
+		return projectSucceeded, false
+	}, func(p contempt.Project, dependency string) {
+		cancelled[p.Name] = dependency
+	})
+
+	assert.ElementsMatch(t, []string{"base", "slow", "tools", "other"}, ran)
+	assert.Equal(t, map[string]string{"app": "tools"}, cancelled)
+	assert.Equal(t, map[string]projectOutcome{
+		"base":  projectSucceeded,
+		"slow":  projectSucceeded,
+		"tools": projectFailed,
+		"app":   projectFailed,
+		"other": projectRefused,
+	}, outcomes(results))
+}
+
+func Test_schedule_unwantedDependentsOfFailedProjects(t *testing.T) {
+	results := schedule(schedulerProjects, 2, func(p contempt.Project, _ bool) bool {
+		return p.Name == "base"
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		return projectFailed, false
+	}, func(p contempt.Project, dependency string) {
+		t.Errorf("unexpected cancellation of %s", p.Name)
+	})
+
+	assert.Equal(t, map[string]projectOutcome{
+		"base":  projectFailed,
+		"slow":  projectSucceeded,
+		"tools": projectSucceeded,
+		"app":   projectSucceeded,
+		"other": projectSucceeded,
+	}, outcomes(results))
+}
+
+func Test_schedule_wantedDependents(t *testing.T) {
+	var ran []string
+	schedule(schedulerProjects, 1, func(p contempt.Project, dependenciesPushed bool) bool {
+		return p.Name == "base" || dependenciesPushed
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		ran = append(ran, p.Name)
+		return projectSucceeded, p.Name == "base"
+	}, func(contempt.Project, string) {
+		t.Fatal("unexpected cancellation")
+	})
+
+	assert.Equal(t, []string{"base", "tools", "other"}, ran)
+}
+
+func Test_schedule_reportsSkippedProjectsWhenBuffered(t *testing.T) {
+	oldWorkers, oldWorkflowCommands, oldStdout := *workers, *workflowCommands, stdout
+	defer func() { *workers, *workflowCommands, stdout = oldWorkers, oldWorkflowCommands, oldStdout }()
+
+	output := &bytes.Buffer{}
+	*workers, *workflowCommands, stdout = 3, false, output
+
+	results := schedule(schedulerProjects, *workers, func(contempt.Project, bool) bool {
+		return true
+	}, func(p contempt.Project) (projectOutcome, bool) {
+		if p.Name == "tools" {
+			return projectFailed, false
+		}
+		return projectSucceeded, false
+	}, skipProject)
+
+	assert.Equal(t, projectFailed, outcomes(results)["app"])
+	assert.Contains(t, output.String(), "Skipping project app as its dependency tools failed")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/csmith/contempt"
+	"github.com/csmith/contempt/internal"
+)
+
+// selectProjects returns the names of the projects matched by a comma-separated filter. Each entry in the filter may
+// be a project's name or the name of its directory, and may be prefixed with "+" to also select everything that
+// depends on it, or suffixed with "+" to also select everything it depends on. An empty filter selects everything.
+func selectProjects(projects []contempt.Project, filter string) map[string]bool {
+	res := make(map[string]bool)
+	if filter == "" {
+		for i := range projects {
+			res[projects[i].Name] = true
+		}
+		return res
+	}
+
+	graph := projectGraph(projects)
+	dependents := internal.Reverse(graph)
+	for _, entry := range strings.Split(filter, ",") {
+		name := strings.TrimSuffix(strings.TrimPrefix(entry, "+"), "+")
+		for i := range projects {
+			if projects[i].Name != name && filepath.Base(filepath.Dir(projects[i].Template)) != name {
+				continue
+			}
+
+			res[projects[i].Name] = true
+			if strings.HasPrefix(entry, "+") {
+				for dependent := range internal.Reachable(dependents, projects[i].Name) {
+					res[dependent] = true
+				}
+			}
+			if strings.HasSuffix(entry, "+") {
+				for dependency := range internal.Reachable(graph, projects[i].Name) {
+					res[dependency] = true
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// changedProjects returns the names of the projects affected by changes to the given files (relative to the input
+// directory), along with all of their dependents. Changes to shared templates or to the root values or policy files
+// affect every project.
+func changedProjects(projects []contempt.Project, files []string, partialsDir string) map[string]bool {
+	var roots []string
+	for _, file := range files {
+		dir := path.Dir(file)
+		if dir == "." && (file == "values.yaml" || file == "policy.yaml") || strings.HasPrefix(file, partialsDir+"/") {
+			log.Printf("%s affects all projects", file)
+			return selectProjects(projects, "")
+		}
+
+		// Files belong to the project in the deepest directory that contains them, as projects may be nested.
+		owner := ""
+		for i := range projects {
+			projectDir := filepath.ToSlash(filepath.Dir(projects[i].Template))
+			if (file == projectDir || strings.HasPrefix(file, projectDir+"/")) && len(projectDir) > len(owner) {
+				owner = projectDir
+			}
+		}
+
+		if owner == "" {
+			continue
+		}
+
+		for i := range projects {
+			if filepath.ToSlash(filepath.Dir(projects[i].Template)) == owner {
+				roots = append(roots, projects[i].Name)
+			}
+		}
+	}
+
+	return internal.Reachable(internal.Reverse(projectGraph(projects)), roots...)
+}
+
+// projectGraph returns a map of each project's name to the names of the projects it depends on.
+func projectGraph(projects []contempt.Project) map[string][]string {
+	res := make(map[string][]string, len(projects))
+	for i := range projects {
+		res[projects[i].Name] = projects[i].Dependencies
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+)
+
+var selectionProjects = []contempt.Project{
+	{Name: "base", Template: "base/Dockerfile.gotpl"},
+	{Name: "tools/web", Template: "tools/web/Dockerfile.gotpl", Dependencies: []string{"base"}},
+	{Name: "apps/site", Template: "apps/site/Dockerfile.gotpl", Dependencies: []string{"tools/web"}},
+	{Name: "apps/web", Template: "apps/web/Dockerfile.gotpl", Dependencies: []string{"base"}},
+	{Name: "other", Template: "other/Dockerfile.gotpl"},
+}
+
+func Test_selectProjects(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   map[string]bool
+	}{
+		{"Empty filter selects everything", "", map[string]bool{"base": true, "tools/web": true, "apps/site": true, "apps/web": true, "other": true}},
+		{"Selects by name", "tools/web,other", map[string]bool{"tools/web": true, "other": true}},
+		{"Selects by directory name", "web", map[string]bool{"tools/web": true, "apps/web": true}},
+		{"Includes dependents", "+tools/web", map[string]bool{"tools/web": true, "apps/site": true}},
+		{"Includes transitive dependents", "+base", map[string]bool{"base": true, "tools/web": true, "apps/site": true, "apps/web": true}},
+		{"Includes dependencies", "apps/site+", map[string]bool{"apps/site": true, "tools/web": true, "base": true}},
+		{"Includes both", "+tools/web+", map[string]bool{"base": true, "tools/web": true, "apps/site": true}},
+		{"Ignores unknown projects", "+nope", map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, selectProjects(selectionProjects, tt.filter))
+		})
+	}
+}
+
+func Test_changedProjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  map[string]bool
+	}{
+		{"No changes", nil, map[string]bool{}},
+		{"Unrelated files", []string{"README.md", "docs/index.md"}, map[string]bool{}},
+		{"Changes include dependents", []string{"tools/web/patch.diff"}, map[string]bool{"tools/web": true, "apps/site": true}},
+		{"Leaf projects", []string{"other/Dockerfile.gotpl", "apps/web/values.yaml"}, map[string]bool{"other": true, "apps/web": true}},
+		{"Shared templates affect everything", []string{"_templates/common.gotpl"}, selectProjects(selectionProjects, "")},
+		{"Root values affect everything", []string{"values.yaml"}, selectProjects(selectionProjects, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, changedProjects(selectionProjects, tt.files, "_templates"))
+		})
+	}
+}
+
+func Test_changedProjects_nested(t *testing.T) {
+	projects := []contempt.Project{
+		{Name: "apps", Template: "apps/Dockerfile.gotpl"},
+		{Name: "apps/web", Template: "apps/web/Dockerfile.gotpl"},
+	}
+	assert.Equal(t, map[string]bool{"apps/web": true}, changedProjects(projects, []string{"apps/web/file"}, "_templates"))
+	assert.Equal(t, map[string]bool{"apps": true}, changedProjects(projects, []string{"apps/file"}, "_templates"))
+}
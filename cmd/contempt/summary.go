@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/csmith/contempt"
+)
+
+var summaryPath = flag.String("summary", "", "Path to write a Markdown summary of the run to. Defaults to $GITHUB_STEP_SUMMARY, if set")
+
+// writeSummary writes a Markdown summary of the run, if a destination has been configured. When writing to GitHub's
+// step summary the summary is appended, as other steps may have already written to it.
+func writeSummary() {
+	target := *summaryPath
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if target == "" {
+		target = os.Getenv("GITHUB_STEP_SUMMARY")
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	if target == "" {
+		return
+	}
+
+	f, err := os.OpenFile(target, flags, os.FileMode(0644))
+	if err != nil {
+		log.Printf("Failed to open summary file %s: %v", target, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(formatSummary(report)); err != nil {
+		log.Printf("Failed to write summary to %s: %v", target, err)
+	}
+}
+
+// formatSummary produces a Markdown summary of the given run.
+func formatSummary(r *runReport) string {
+	builder := &strings.Builder{}
+	builder.WriteString("## Contempt summary\n\n")
+
+	if r.Error != "" {
+		builder.WriteString(fmt.Sprintf("> [!CAUTION]\n> %s\n\n", markdownEscape(r.Error)))
+	}
+
+	var interesting []*projectReport
+	for i := range r.Projects {
+		p := r.Projects[i]
+		if len(p.Changes) > 0 || len(p.Advisories) > 0 || p.Build != stepSkipped || p.Push != stepSkipped || p.Error != "" {
+			interesting = append(interesting, p)
+		}
+	}
+
+	if len(interesting) == 0 {
+		builder.WriteString(fmt.Sprintf("Checked %d project(s); no changes detected.\n", len(r.Projects)))
+		return builder.String()
+	}
+
+	builder.WriteString("| Project | Changes | Build | Push |\n")
+	builder.WriteString("|---------|---------|-------|------|\n")
+	for _, p := range interesting {
+		changes := fmt.Sprintf("%d", len(p.Changes))
+		if marker := changeMarker(p.Changes); marker != "" {
+			changes += fmt.Sprintf(" (%s)", marker)
+		}
+		if p.Error != "" {
+			changes += " ⚠️"
+		}
+		push := formatStatus(p.Push)
+		if failed := p.mirrorsFailed(); failed > 0 {
+			push += fmt.Sprintf(" (%d/%d mirrors failed)", failed, len(p.Mirrors))
+		}
+		builder.WriteString(fmt.Sprintf(
+			"| %s | %s | %s | %s |\n",
+			markdownEscape(p.Name),
+			changes,
+			formatStatus(p.Build),
+			push,
+		))
+	}
+
+	for _, p := range interesting {
+		if len(p.Changes) == 0 && len(p.Advisories) == 0 && p.Error == "" {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("\n### %s\n\n", markdownEscape(p.Name)))
+		if p.Error != "" {
+			builder.WriteString(fmt.Sprintf("> [!WARNING]\n> %s\n\n", markdownEscape(p.Error)))
+		}
+
+		for _, f := range p.Advisories {
+			builder.WriteString(fmt.Sprintf("- :warning: %s\n", markdownEscape(formatFinding(f))))
+		}
+		if len(p.Advisories) > 0 {
+			builder.WriteString("\n")
+		}
+
+		if len(p.Changes) == 0 {
+			continue
+		}
+
+		builder.WriteString("| Material | Change | Old | New | |\n")
+		builder.WriteString("|----------|--------|-----|-----|-|\n")
+		for _, c := range p.Changes {
+			kind := string(c.Kind)
+			if c.Bump != "" {
+				kind += fmt.Sprintf(" (%s)", c.Bump)
+			}
+
+			link := ""
+			if url := compareURL(c); url != "" {
+				link = fmt.Sprintf("[compare](%s)", url)
+			}
+
+			builder.WriteString(fmt.Sprintf(
+				"| %s | %s | %s | %s | %s |\n",
+				markdownEscape(c.Material),
+				kind,
+				formatVersion(c.OldVersion()),
+				formatVersion(c.NewVersion()),
+				link,
+			))
+		}
+	}
+
+	return builder.String()
+}
+
+// compareURL returns a link to view the upstream changes between the old and new versions of a git-based material,
+// or an empty string if the material isn't hosted somewhere that supports comparisons.
+func compareURL(c contempt.Change) string {
+	if c.Old == nil || c.New == nil || (c.New.Type != "github" && c.New.Type != "git") {
+		return ""
+	}
+
+	// Prefer commit hashes, as tags may have had a prefix stripped from their version. If the old material doesn't
+	// have one (e.g. it was read from a legacy BOM), assume its tag had the same prefix as the new one.
+	oldRef, newRef := c.Old.Version, c.New.Version
+	if strings.HasPrefix(c.Old.Digest, "sha1:") && strings.HasPrefix(c.New.Digest, "sha1:") {
+		oldRef, newRef = digestHash(c.Old.Digest), digestHash(c.New.Digest)
+	} else if strings.HasSuffix(c.New.Tag, c.New.Version) {
+		prefix := strings.TrimSuffix(c.New.Tag, c.New.Version)
+		oldRef, newRef = prefix+c.Old.Version, c.New.Tag
+	}
+
+	repo := strings.TrimSuffix(strings.TrimSuffix(c.New.Source, "/"), ".git")
+	switch {
+	case strings.HasPrefix(repo, "https://github.com/"):
+		return fmt.Sprintf("%s/compare/%s...%s", repo, oldRef, newRef)
+	case strings.HasPrefix(repo, "https://gitlab.com/"):
+		return fmt.Sprintf("%s/-/compare/%s...%s", repo, oldRef, newRef)
+	default:
+		return ""
+	}
+}
+
+func formatStatus(status stepStatus) string {
+	switch status {
+	case stepSucceeded:
+		return "✅ succeeded"
+	case stepFailed:
+		return "❌ failed"
+	default:
+		return "➖ skipped"
+	}
+}
+
+// formatVersion formats a version for display in a table, truncating long values such as image digests.
+func formatVersion(version string) string {
+	if version == "" {
+		return "-"
+	}
+	return fmt.Sprintf("`%.12s`", markdownEscape(version))
+}
+
+// markdownEscape escapes characters that would break the layout of a Markdown table.
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+}
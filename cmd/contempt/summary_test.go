@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_compareURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		change contempt.Change
+		want   string
+	}{
+		{
+			"Non-git material",
+			contempt.Change{Old: &contempt.Material{Type: "apk", Version: "1"}, New: &contempt.Material{Type: "apk", Version: "2"}},
+			"",
+		},
+		{
+			"Added material",
+			contempt.Change{New: &contempt.Material{Type: "github", Source: "https://github.com/csmith/contempt", Version: "v1.0.0"}},
+			"",
+		},
+		{
+			"GitHub material with commits",
+			contempt.Change{
+				Old: &contempt.Material{Type: "github", Source: "https://github.com/csmith/contempt", Version: "1.0.0", Digest: "sha1:abc"},
+				New: &contempt.Material{Type: "github", Source: "https://github.com/csmith/contempt", Version: "1.1.0", Digest: "sha1:def"},
+			},
+			"https://github.com/csmith/contempt/compare/abc...def",
+		},
+		{
+			"Git material on GitHub migrated from a legacy BOM",
+			contempt.Change{
+				Old: &contempt.Material{Type: "git", Version: "v1.0.0"},
+				New: &contempt.Material{Type: "git", Source: "https://github.com/csmith/contempt.git", Version: "v1.1.0", Digest: "sha1:def"},
+			},
+			"https://github.com/csmith/contempt/compare/v1.0.0...v1.1.0",
+		},
+		{
+			"GitHub material with a prefix migrated from a legacy BOM",
+			contempt.Change{
+				Old: &contempt.Material{Type: "github", Version: "1.0.0"},
+				New: &contempt.Material{Type: "github", Source: "https://github.com/csmith/contempt", Version: "1.1.0", Tag: "v1.1.0", Digest: "sha1:def"},
+			},
+			"https://github.com/csmith/contempt/compare/v1.0.0...v1.1.0",
+		},
+		{
+			"Git material on GitLab",
+			contempt.Change{
+				Old: &contempt.Material{Type: "git", Source: "https://gitlab.com/foo/bar", Version: "v1.0.0"},
+				New: &contempt.Material{Type: "git", Source: "https://gitlab.com/foo/bar", Version: "v1.1.0"},
+			},
+			"https://gitlab.com/foo/bar/-/compare/v1.0.0...v1.1.0",
+		},
+		{
+			"Git material elsewhere",
+			contempt.Change{
+				Old: &contempt.Material{Type: "git", Source: "https://git.sr.ht/~csmith/foo", Version: "v1.0.0"},
+				New: &contempt.Material{Type: "git", Source: "https://git.sr.ht/~csmith/foo", Version: "v1.1.0"},
+			},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, compareURL(tt.change))
+		})
+	}
+}
+
+func Test_formatSummary(t *testing.T) {
+	r := &runReport{
+		Projects: []*projectReport{
+			{Name: "unchanged", Build: stepSkipped, Push: stepSkipped},
+			{
+				Name: "image1",
+				Changes: []contempt.Change{
+					{
+						Material: "apk:musl",
+						Kind:     contempt.Upgraded,
+						Bump:     contempt.PatchBump,
+						Old:      &contempt.Material{Type: "apk", Version: "1.2.4-r1"},
+						New:      &contempt.Material{Type: "apk", Version: "1.2.4-r2"},
+					},
+					{
+						Material: "apk:libssl3",
+						Kind:     contempt.Removed,
+						Old:      &contempt.Material{Type: "apk", Version: "3.1.4-r1"},
+					},
+				},
+				Build: stepSucceeded,
+				Push:  stepFailed,
+				Error: "Failed to push image1 after 3 attempts",
+			},
+		},
+	}
+
+	assert.Equal(t, `## Contempt summary
+
+| Project | Changes | Build | Push |
+|---------|---------|-------|------|
+| image1 | 2 (patch) ⚠️ | ✅ succeeded | ❌ failed |
+
+### image1
+
+> [!WARNING]
+> Failed to push image1 after 3 attempts
+
+| Material | Change | Old | New | |
+|----------|--------|-----|-----|-|
+| apk:musl | upgraded (patch) | `+"`1.2.4-r1`"+` | `+"`1.2.4-r2`"+` |  |
+| apk:libssl3 | removed | `+"`3.1.4-r1`"+` | - |  |
+`, formatSummary(r))
+}
+
+func Test_formatSummary_mirrorFailures(t *testing.T) {
+	r := &runReport{
+		Projects: []*projectReport{
+			{
+				Name:    "image1",
+				Changes: []contempt.Change{},
+				Build:   stepSucceeded,
+				Push:    stepSucceeded,
+				Mirrors: []*mirrorReport{
+					{Registry: "reg.example.com", Status: stepSucceeded},
+					{Registry: "ghcr.io/example", Status: stepFailed},
+				},
+				Error: "Failed to copy image1 to 1 of 2 registries: ghcr.io/example",
+			},
+		},
+	}
+
+	assert.Contains(t, formatSummary(r), "| image1 | 0 ⚠️ | ✅ succeeded | ✅ succeeded (1/2 mirrors failed) |\n")
+}
+
+func Test_formatSummary_noChanges(t *testing.T) {
+	r := &runReport{
+		Projects: []*projectReport{
+			{Name: "unchanged", Build: stepSkipped, Push: stepSkipped},
+		},
+	}
+
+	assert.Equal(t, "## Contempt summary\n\nChecked 1 project(s); no changes detected.\n", formatSummary(r))
+}
+
+func Test_writeSummary_stepSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.md")
+	require.NoError(t, os.WriteFile(path, []byte("previous step\n"), 0600))
+	t.Setenv("GITHUB_STEP_SUMMARY", path)
+
+	oldWorkflowCommands := *workflowCommands
+	*workflowCommands = false
+	defer func() { *workflowCommands = oldWorkflowCommands }()
+
+	writeSummary()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "previous step\n## Contempt summary\n"))
+}
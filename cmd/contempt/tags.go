@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/csmith/contempt"
+	"github.com/hashicorp/go-version"
+)
+
+var tagTemplates = flag.String("tags", "", "A comma-separated list of templates for extra tags to push each image with, e.g. {{.Date}}. Projects can override this with 'tags' in their values")
+
+// tagPattern matches valid image tags.
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// tagData is the data passed to tag templates.
+type tagData struct {
+	// Project is the name of the project.
+	Project string
+	// Date is the date the run started, in the form YYYYMMDD.
+	Date string
+
+	commit string
+}
+
+// GitSHA returns the SHA of the commit the image was built from. If the project wasn't committed, this is the
+// current HEAD of the output repository.
+func (d tagData) GitSHA() (string, error) {
+	if d.commit != "" {
+		return d.commit, nil
+	}
+
+	// Other projects may be committing concurrently.
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	return gitOutput("-C", outputDir, "rev-parse", "HEAD")
+}
+
+// imageTags renders the given tag templates. Each template may produce several whitespace-separated tags (e.g. when
+// using the semver function); templates that render to nothing are ignored. Materials are the project's resolved
+// materials, made available to the template through the material function.
+func imageTags(templates []string, data tagData, materials map[string]contempt.Material) ([]string, error) {
+	funcs := template.FuncMap{
+		"material": func(name string) (string, error) {
+			m, ok := materials[name]
+			if !ok {
+				return "", fmt.Errorf("project doesn't use material %s", name)
+			}
+			return m.Version, nil
+		},
+		"semver": semverTags,
+	}
+
+	var res []string
+	seen := make(map[string]bool)
+	for i := range templates {
+		tpl, err := template.New("tag").Funcs(funcs).Parse(templates[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag template %q: %v", templates[i], err)
+		}
+
+		buffer := &bytes.Buffer{}
+		if err := tpl.Execute(buffer, data); err != nil {
+			return nil, fmt.Errorf("unable to render tag template %q: %v", templates[i], err)
+		}
+
+		for _, tag := range strings.Fields(buffer.String()) {
+			if !tagPattern.MatchString(tag) {
+				return nil, fmt.Errorf("tag template %q produced invalid tag %q", templates[i], tag)
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				res = append(res, tag)
+			}
+		}
+	}
+	return res, nil
+}
+
+// semverTags expands a version into tags for each level of precision, e.g. "v1.2.3" becomes "1 1.2 1.2.3". A "v"
+// prefix and any build metadata are removed. Alpine package revisions (e.g. "1.2.3-r1") add a final level of
+// precision, rather than being treated as pre-releases. Pre-release versions aren't expanded, as they shouldn't
+// replace the release that "1" or "1.2" refers to.
+func semverTags(v string) (string, error) {
+	trimmed, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), "+")
+
+	revision := ""
+	if i := strings.LastIndex(trimmed, "-r"); i != -1 && isDigits(trimmed[i+2:]) {
+		trimmed, revision = trimmed[:i], trimmed[i:]
+	}
+
+	parsed, err := version.NewSemver(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse version %s: %v", v, err)
+	}
+
+	if parsed.Prerelease() != "" {
+		return trimmed + revision, nil
+	}
+
+	parts := strings.Split(trimmed, ".")
+	var res []string
+	for i := range parts {
+		res = append(res, strings.Join(parts[:i+1], "."))
+	}
+	if revision != "" {
+		res = append(res, trimmed+revision)
+	}
+	return strings.Join(res, " "), nil
+}
+
+// isDigits determines whether the given string is non-empty and consists only of digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/csmith/contempt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tagMaterials = map[string]contempt.Material{
+	"github:foo/bar": {Type: "github", Version: "v1.2.3"},
+	"apk:openssl":    {Type: "apk", Version: "3.1.4-r5"},
+}
+
+func Test_imageTags(t *testing.T) {
+	tags, err := imageTags([]string{
+		"{{.Date}}",
+		"{{slice .GitSHA 0 7}}",
+		`{{material "github:foo/bar" | semver}}`,
+		`openssl-{{material "apk:openssl"}}`,
+		`{{material "apk:openssl" | semver}}`,
+		"latest",
+		`{{if false}}never{{end}}`,
+	}, tagData{Project: "tools/web", Date: "20261019", commit: "0123456789abcdef"}, tagMaterials)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20261019", "0123456", "1", "1.2", "1.2.3", "openssl-3.1.4-r5", "3", "3.1", "3.1.4", "3.1.4-r5", "latest"}, tags)
+}
+
+func Test_imageTags_errors(t *testing.T) {
+	for _, tpl := range []string{
+		"{{.Missing}}",
+		`{{material "github:missing/repo"}}`,
+		"{{",
+		"not:valid",
+		`{{"latest" | semver}}`,
+	} {
+		_, err := imageTags([]string{tpl}, tagData{Project: "web", Date: "20261019"}, tagMaterials)
+		assert.Error(t, err, tpl)
+	}
+}
+
+func Test_semverTags(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.2.3", "1 1.2 1.2.3"},
+		{"1.22", "1 1.22"},
+		{"16", "16"},
+		{"1.2.3+build.5", "1 1.2 1.2.3"},
+		{"1.2.3-rc.1", "1.2.3-rc.1"},
+		{"1.2.3-r0", "1 1.2 1.2.3 1.2.3-r0"},
+		{"3.1.4-r15", "3 3.1 3.1.4 3.1.4-r15"},
+		{"1.2.3-rc.1-r2", "1.2.3-rc.1-r2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := semverTags(tt.version)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, v := range []string{"latest", "go1.22", "release-1.2.3"} {
+		_, err := semverTags(v)
+		assert.Error(t, err, v)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/csmith/contempt/internal"
 	"github.com/csmith/envflag"
-	"golang.org/x/exp/slices"
 	"gopkg.in/osteele/liquid.v1"
 	"io/fs"
 	"os"
@@ -19,8 +18,15 @@ var (
 	registry = flags.String("registry", "", "The name of the registry that images are pushed to")
 	template = flags.String("template", "", "Path of the template to read")
 	output   = flags.String("output", "", "Path to output the generated file")
+
+	changedSince = flags.String("changed-since", "", "Only include targets with files changed since the given git ref, and their dependents")
 )
 
+// optionalFlags contains the names of flags that may be left empty.
+var optionalFlags = map[string]bool{
+	"changed-since": true,
+}
+
 func main() {
 	envflag.Parse(envflag.WithFlagSet(flags))
 
@@ -31,7 +37,7 @@ func main() {
 	}
 
 	flags.VisitAll(func(f *flag.Flag) {
-		if f.Value.String() == "" {
+		if f.Value.String() == "" && !optionalFlags[f.Name] {
 			_, _ = fmt.Fprintf(os.Stderr, "Missing required flag: %s\n", f.Name)
 			flags.Usage()
 			os.Exit(2)
@@ -50,8 +56,15 @@ func main() {
 	}
 
 	var deps []target
+	seen := make(map[string]string)
 	for i := range files {
-		name := path.Base(path.Dir(files[i]))
+		name := path.Dir(files[i])
+		if other, ok := seen[name]; ok {
+			_, _ = fmt.Fprintf(os.Stderr, "Duplicate project name %s: found %s and %s\n", name, other, files[i])
+			os.Exit(4)
+		}
+		seen[name] = files[i]
+
 		needed, err := readDependencies(s, *registry, files[i])
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "Failed to find dependencies of %s: %v\n", files[i], err)
@@ -67,6 +80,15 @@ func main() {
 		os.Exit(5)
 	}
 
+	if *changedSince != "" {
+		changed, err := internal.ChangedFiles(flags.Arg(0), *changedSince)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to find changed files: %v\n", err)
+			os.Exit(5)
+		}
+		deps = changedTargets(deps, changed)
+	}
+
 	tpl, err := os.ReadFile(*template)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Failed to load template from '%s': %v\n", *template, err)
@@ -103,7 +125,7 @@ func readDependencies(s fs.FS, registry string, p string) ([]string, error) {
 	defer f.Close()
 
 	// Ignore dependencies on yourself
-	ownName := path.Base(path.Dir(p))
+	ownName := strings.ToLower(path.Dir(p))
 
 	var dependencies []string
 	repo := fmt.Sprintf("%s/", strings.ToLower(registry))
@@ -114,7 +136,9 @@ func readDependencies(s fs.FS, registry string, p string) ([]string, error) {
 		if len(parts) >= 2 && parts[0] == "from" && strings.HasPrefix(parts[1], repo) {
 			name := strings.TrimPrefix(parts[1], repo)
 			name, _, _ = strings.Cut(name, "@")
-			name, _, _ = strings.Cut(name, ":")
+			if index := strings.LastIndexByte(name, ':'); index > strings.LastIndexByte(name, '/') {
+				name = name[:index]
+			}
 			if name != ownName {
 				dependencies = append(dependencies, name)
 			}
@@ -128,47 +152,64 @@ func readDependencies(s fs.FS, registry string, p string) ([]string, error) {
 	return dependencies, nil
 }
 
-// TODO: There's probably a better way to do this (e.g. by traversing the graph). Do that and test.
+// orderDependencies sorts the targets so that each one comes after all the targets it needs.
 func orderDependencies(deps []target) ([]target, error) {
-	var ordered []target
-
-	satisfied := func(dep target) bool {
-		for i := range dep.Needed {
-			found := false
-			for j := range ordered {
-				if ordered[j].Name == dep.Needed[i] {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return false
-			}
-		}
-		return true
+	graph := make(map[string][]string, len(deps))
+	targets := make(map[string]target, len(deps))
+	for i := range deps {
+		graph[deps[i].Name] = deps[i].Needed
+		targets[deps[i].Name] = deps[i]
 	}
 
-	for len(deps) > 0 {
-		var batch []target
-		var remaining []target
-		for d := range deps {
-			if satisfied(deps[d]) {
-				batch = append(batch, deps[d])
-			} else {
-				remaining = append(remaining, deps[d])
+	names, err := internal.TopologicalSort(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]target, len(names))
+	for i := range names {
+		ordered[i] = targets[names[i]]
+	}
+	return ordered, nil
+}
+
+// changedTargets returns the targets that contain any of the changed files, along with all of their dependents. The
+// order of the targets is preserved, and any needed targets that aren't included are removed.
+func changedTargets(deps []target, changed []string) []target {
+	graph := make(map[string][]string, len(deps))
+	for i := range deps {
+		graph[deps[i].Name] = deps[i].Needed
+	}
+
+	var roots []string
+	for _, file := range changed {
+		// Files belong to the target in the deepest directory that contains them, as targets may be nested.
+		owner := ""
+		for i := range deps {
+			if strings.HasPrefix(file, deps[i].Name+"/") && len(deps[i].Name) > len(owner) {
+				owner = deps[i].Name
 			}
 		}
-		deps = remaining
+		if owner != "" {
+			roots = append(roots, owner)
+		}
+	}
 
-		if len(batch) == 0 {
-			return nil, fmt.Errorf("could not find any satisfied dependencies - is there a loop? Pending: %#v, selected: %#v", deps, ordered)
+	included := internal.Reachable(internal.Reverse(graph), roots...)
+
+	var res []target
+	for i := range deps {
+		if !included[deps[i].Name] {
+			continue
 		}
 
-		slices.SortFunc(batch, func(i, j target) bool {
-			return i.Name < j.Name
-		})
-		ordered = append(ordered, batch...)
+		var needed []string
+		for _, n := range deps[i].Needed {
+			if included[n] {
+				needed = append(needed, n)
+			}
+		}
+		res = append(res, target{deps[i].Name, needed})
 	}
-
-	return ordered, nil
+	return res
 }
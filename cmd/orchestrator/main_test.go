@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_orderDependencies(t *testing.T) {
+	ordered, err := orderDependencies([]target{
+		{"web", []string{"base"}},
+		{"base", nil},
+		{"apps/site", []string{"web"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []target{{"base", nil}, {"web", []string{"base"}}, {"apps/site", []string{"web"}}}, ordered)
+
+	_, err = orderDependencies([]target{{"a", []string{"b"}}, {"b", []string{"a"}}})
+	assert.EqualError(t, err, "dependency cycle (a → b → a)")
+}
+
+func Test_changedTargets(t *testing.T) {
+	deps := []target{
+		{"base", nil},
+		{"other", nil},
+		{"web", []string{"base"}},
+		{"apps/site", []string{"web", "other"}},
+	}
+
+	assert.Equal(t, []target{{"web", nil}, {"apps/site", []string{"web"}}}, changedTargets(deps, []string{"web/Dockerfile", "README.md"}))
+	assert.Equal(t, []target{{"other", nil}, {"apps/site", []string{"other"}}}, changedTargets(deps, []string{"other/file"}))
+	assert.Nil(t, changedTargets(deps, nil))
+}
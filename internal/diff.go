@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a unified diff.
+const diffContext = 3
+
+// UnifiedDiff produces a unified diff between two texts, labelled with the given names. If the texts are identical,
+// an empty string is returned.
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	ops := diffLines(a, b)
+
+	builder := &strings.Builder{}
+	builder.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+
+	// Group the operations into hunks, each containing changes plus surrounding context.
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		hunkStart := start - diffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+
+		// Extend the hunk until there's a run of unchanged lines long enough to separate it from the next change.
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+
+		hunkEnd := end + diffContext
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		writeHunk(builder, ops[hunkStart:hunkEnd])
+		start = hunkEnd
+	}
+
+	return builder.String()
+}
+
+type diffOp struct {
+	kind    byte
+	line    string
+	oldLine int
+	newLine int
+}
+
+// writeHunk writes a single hunk, with its header, to the builder.
+func writeHunk(builder *strings.Builder, ops []diffOp) {
+	oldStart, newStart := ops[0].oldLine, ops[0].newLine
+	oldCount, newCount := 0, 0
+	for i := range ops {
+		if ops[i].kind != '+' {
+			oldCount++
+		}
+		if ops[i].kind != '-' {
+			newCount++
+		}
+	}
+
+	builder.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount)))
+	for i := range ops {
+		builder.WriteByte(ops[i].kind)
+		builder.WriteString(ops[i].line)
+		builder.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the start and length of a range in a hunk header, using the conventions of GNU diff.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines computes the operations required to turn a into b, based on their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			ops = append(ops, diffOp{kind: ' ', line: a[i], oldLine: i + 1, newLine: j + 1})
+			i++
+			j++
+		} else if j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]) {
+			ops = append(ops, diffOp{kind: '+', line: b[j], oldLine: i + 1, newLine: j + 1})
+			j++
+		} else {
+			ops = append(ops, diffOp{kind: '-', line: a[i], oldLine: i + 1, newLine: j + 1})
+			i++
+		}
+	}
+	return ops
+}
+
+// splitLines splits text into lines, ignoring any trailing newline.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{
+			"Returns nothing for identical texts",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			"",
+		},
+		{
+			"Shows a single changed line",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"Shows an entirely new file",
+			"",
+			"a\nb\n",
+			"--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"Limits context around changes",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\n2\n3\n4\n5\n6\n7\nEIGHT\n",
+			"--- old\n+++ new\n@@ -5,4 +5,4 @@\n 5\n 6\n 7\n-8\n+EIGHT\n",
+		},
+		{
+			"Splits distant changes into separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"ONE\n2\n3\n4\n5\n6\n7\n8\n9\nTEN\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+ONE\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+TEN\n",
+		},
+		{
+			"Merges nearby changes into one hunk",
+			"1\n2\n3\n4\n5\n",
+			"ONE\n2\n3\n4\nFIVE\n",
+			"--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+ONE\n 2\n 3\n 4\n-5\n+FIVE\n",
+		},
+		{
+			"Shows removed lines",
+			"a\nb\nc\n",
+			"a\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,2 @@\n a\n-b\n c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, UnifiedDiff("old", "new", tt.oldText, tt.newText))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ChangedFiles returns the paths, relative to dir, of all files within dir that have changed between the merge base
+// of ref and HEAD, and HEAD. Renamed files are reported under both their old and new names.
+func ChangedFiles(dir, ref string) ([]string, error) {
+	cmd := exec.Command("git", "-C", dir, "diff", "--name-only", "--relative", "--no-renames", fmt.Sprintf("%s...HEAD", ref))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find files changed since %s: %v", ref, err)
+	}
+
+	var res []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
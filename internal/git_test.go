@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	git("init", "-q")
+	write("input/base/Dockerfile.gotpl", "FROM scratch")
+	write("input/web/Dockerfile.gotpl", "FROM scratch")
+	write("README.md", "hello")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "start")
+
+	write("input/web/Dockerfile.gotpl", "FROM base")
+	write("README.md", "changed, but outside the input directory")
+	git("mv", "input/base", "input/core")
+	git("add", ".")
+	git("commit", "-q", "-m", "changes")
+
+	files, err := ChangedFiles(filepath.Join(dir, "input"), "start")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"base/Dockerfile.gotpl", "core/Dockerfile.gotpl", "web/Dockerfile.gotpl"}, files)
+
+	_, err = ChangedFiles(dir, "no-such-ref")
+	assert.Error(t, err)
+}
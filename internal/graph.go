@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyError describes why a set of dependencies couldn't be ordered.
+type DependencyError struct {
+	// Missing maps nodes to any of their dependencies that don't exist.
+	Missing map[string][]string
+	// Cycle is the shortest dependency cycle found, starting and ending with the same node.
+	Cycle []string
+}
+
+func (e *DependencyError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		var names []string
+		for name := range e.Missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var missing []string
+		for _, name := range names {
+			missing = append(missing, fmt.Sprintf("%s needs %s", name, strings.Join(e.Missing[name], ", ")))
+		}
+		problems = append(problems, fmt.Sprintf("unknown dependencies (%s)", strings.Join(missing, "; ")))
+	}
+
+	if len(e.Cycle) > 0 {
+		problems = append(problems, fmt.Sprintf("dependency cycle (%s)", strings.Join(e.Cycle, " → ")))
+	}
+
+	return strings.Join(problems, " and ")
+}
+
+// TopologicalSort orders the nodes of a dependency graph, given as a map of each node to the nodes it depends on, so
+// that every node comes after all of its dependencies. Nodes are ordered in batches, where each batch contains all
+// the nodes whose dependencies are satisfied by earlier batches, sorted by name.
+//
+// If any dependencies don't exist in the graph, or there is a cycle, a *DependencyError is returned.
+func TopologicalSort(graph map[string][]string) ([]string, error) {
+	depErr := &DependencyError{Missing: make(map[string][]string)}
+	for node := range graph {
+		for _, dep := range graph[node] {
+			if _, ok := graph[dep]; !ok {
+				depErr.Missing[node] = append(depErr.Missing[node], dep)
+			}
+		}
+	}
+
+	var res []string
+	done := make(map[string]bool, len(graph))
+	remaining := make(map[string]bool, len(graph))
+	for node := range graph {
+		remaining[node] = true
+	}
+
+	for len(remaining) > 0 {
+		var batch []string
+		for node := range remaining {
+			satisfied := true
+			for _, dep := range graph[node] {
+				// Missing dependencies have already been reported, so don't let them block anything else.
+				if _, ok := graph[dep]; ok && !done[dep] {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				batch = append(batch, node)
+			}
+		}
+
+		if len(batch) == 0 {
+			depErr.Cycle = shortestCycle(graph, remaining)
+			break
+		}
+
+		sort.Strings(batch)
+		for _, node := range batch {
+			done[node] = true
+			delete(remaining, node)
+		}
+		res = append(res, batch...)
+	}
+
+	if len(depErr.Missing) > 0 || len(depErr.Cycle) > 0 {
+		for node := range depErr.Missing {
+			sort.Strings(depErr.Missing[node])
+		}
+		return nil, depErr
+	}
+	return res, nil
+}
+
+// shortestCycle finds the shortest cycle between the given nodes, preferring cycles that start with nodes that sort
+// earlier.
+func shortestCycle(graph map[string][]string, nodes map[string]bool) []string {
+	var starts []string
+	for node := range nodes {
+		starts = append(starts, node)
+	}
+	sort.Strings(starts)
+
+	var best []string
+	for _, start := range starts {
+		if cycle := cycleFrom(graph, nodes, start); cycle != nil && (best == nil || len(cycle) < len(best)) {
+			best = cycle
+		}
+	}
+	return best
+}
+
+// cycleFrom performs a breadth-first search from start, returning the shortest path that leads back to it (if any).
+// Only the given nodes are considered.
+func cycleFrom(graph map[string][]string, nodes map[string]bool, start string) []string {
+	previous := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		deps := append([]string{}, graph[current]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if dep == start {
+				cycle := []string{start}
+				for node := current; node != start; node = previous[node] {
+					cycle = append([]string{node}, cycle...)
+				}
+				return append([]string{start}, cycle...)
+			}
+
+			if _, seen := previous[dep]; nodes[dep] && !seen {
+				previous[dep] = current
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// Reverse returns a graph with all the edges of the given graph reversed, e.g. mapping each node to its dependents
+// instead of its dependencies.
+func Reverse(graph map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(graph))
+	for node := range graph {
+		for _, dep := range graph[node] {
+			res[dep] = append(res[dep], node)
+		}
+	}
+	for node := range res {
+		sort.Strings(res[node])
+	}
+	return res
+}
+
+// Reachable returns the given nodes along with every node that can be reached from them in the graph.
+func Reachable(graph map[string][]string, nodes ...string) map[string]bool {
+	res := make(map[string]bool)
+	queue := append([]string{}, nodes...)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if res[node] {
+			continue
+		}
+		res[node] = true
+		queue = append(queue, graph[node]...)
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopologicalSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		graph   map[string][]string
+		want    []string
+		wantErr string
+	}{
+		{
+			"Orders dependencies before dependents",
+			map[string][]string{
+				"app":   {"base", "tools"},
+				"tools": {"base"},
+				"base":  nil,
+				"other": nil,
+			},
+			[]string{"base", "other", "tools", "app"},
+			"",
+		},
+		{
+			"Reports the shortest cycle",
+			map[string][]string{
+				"a":    {"b"},
+				"b":    {"c"},
+				"c":    {"a", "d"},
+				"d":    {"c"},
+				"e":    {"a"},
+				"base": nil,
+			},
+			nil,
+			"dependency cycle (c → d → c)",
+		},
+		{
+			"Reports self-dependencies",
+			map[string][]string{
+				"a": {"a"},
+			},
+			nil,
+			"dependency cycle (a → a)",
+		},
+		{
+			"Reports missing dependencies",
+			map[string][]string{
+				"a":    {"z", "base", "y"},
+				"b":    {"y"},
+				"base": nil,
+			},
+			nil,
+			"unknown dependencies (a needs y, z; b needs y)",
+		},
+		{
+			"Reports missing dependencies and cycles together",
+			map[string][]string{
+				"a": {"b", "missing"},
+				"b": {"a"},
+			},
+			nil,
+			"unknown dependencies (a needs missing) and dependency cycle (a → b → a)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TopologicalSort(tt.graph)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReachable(t *testing.T) {
+	graph := map[string][]string{
+		"app":   {"tools"},
+		"tools": {"base"},
+		"other": {"base"},
+	}
+
+	assert.Equal(t, map[string]bool{"app": true, "tools": true, "base": true}, Reachable(graph, "app"))
+	assert.Equal(t, map[string]bool{"base": true, "tools": true, "app": true, "other": true}, Reachable(Reverse(graph), "base"))
+	assert.Equal(t, map[string]bool{}, Reachable(graph))
+}
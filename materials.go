@@ -2,51 +2,240 @@ package contempt
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
+	"time"
 )
 
-var materials map[string]string
+// bomSchema is the current version of the BOM format written to output files.
+const bomSchema = 2
 
-func readBillOfMaterials(target string) map[string]string {
-	res := make(map[string]string)
+// Material describes a single input that was resolved while generating a project.
+type Material struct {
+	// Type is the kind of material, e.g. "apk", "image" or "release".
+	Type string `json:"type"`
+	// Source is where the material was resolved from, such as a registry, repository or URL.
+	Source string `json:"source,omitempty"`
+	// Version is the resolved version of the material. For images this is the hex-encoded digest.
+	Version string `json:"version"`
+	// Digest is the digest or checksum of the material, prefixed with the algorithm (e.g. "sha256:...").
+	Digest string `json:"digest,omitempty"`
+	// Licence is the licence the material is distributed under, if known.
+	Licence string `json:"licence,omitempty"`
+	// Platforms are the digests of each platform-specific image, keyed by platform, for multi-platform images built
+	// by this repo.
+	Platforms map[string]string `json:"platforms,omitempty"`
+	// Resolved is the time the material was first resolved at this version.
+	Resolved *time.Time `json:"resolved,omitempty"`
+	// Tag is the full name of the tag a git material was resolved from, which may include a prefix that was removed
+	// from its version. It is only populated during rendering, and isn't recorded in the BOM.
+	Tag string `json:"-"`
+	// RequiredBy is the chain of materials that caused this one to be included, starting with the one that was
+	// requested directly. It is only populated during rendering, and isn't recorded in the BOM.
+	RequiredBy []string `json:"-"`
+}
+
+// bom is the structure of the bill of materials written to output files.
+type bom struct {
+	Schema    int                 `json:"schema"`
+	Materials map[string]Material `json:"materials"`
+}
+
+func readBillOfMaterials(target string) map[string]Material {
+	res, err := loadBillOfMaterials(target)
+	if err != nil {
+		log.Printf("Unable to read BOM from existing file: %v", err)
+		return make(map[string]Material)
+	}
+	return res
+}
+
+// loadBillOfMaterials reads the BOM from the header of the given output file.
+func loadBillOfMaterials(target string) (map[string]Material, error) {
 	bs, err := os.ReadFile(target)
 	if err != nil {
-		log.Printf("Unable to read existing file (%s) for BOM: %v", target, err)
-		return res
+		return nil, err
 	}
 
-	bomLine := strings.SplitN(string(bs), "\n", 3)[1]
-	if !strings.HasPrefix(bomLine, "# BOM: ") {
-		log.Printf("Existing file (%s) does not appear to have a BOM", target)
-		return res
+	lines := strings.SplitN(string(bs), "\n", 3)
+	if len(lines) < 2 || !strings.HasPrefix(lines[1], "# BOM: ") {
+		return nil, fmt.Errorf("%s does not appear to have a BOM", target)
 	}
 
-	if err := json.Unmarshal([]byte(strings.TrimPrefix(bomLine, "# BOM: ")), &res); err != nil {
-		log.Printf("Existing file (%s) has invalid BOM: %v", target, err)
-		return res
+	res, err := parseBillOfMaterials(strings.TrimPrefix(lines[1], "# BOM: "))
+	if err != nil {
+		return nil, fmt.Errorf("%s has invalid BOM: %v", target, err)
 	}
+	return res, nil
+}
 
-	return res
+// parseBillOfMaterials parses a BOM in either the current format, or the original format of a flat map of material
+// names to versions.
+func parseBillOfMaterials(data string) (map[string]Material, error) {
+	var versioned bom
+	if err := json.Unmarshal([]byte(data), &versioned); err == nil && versioned.Schema >= bomSchema {
+		if versioned.Materials == nil {
+			versioned.Materials = make(map[string]Material)
+		}
+		return versioned.Materials, nil
+	}
+
+	var legacy map[string]string
+	if err := json.Unmarshal([]byte(data), &legacy); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]Material, len(legacy))
+	for k := range legacy {
+		res[k] = Material{
+			Type:    materialType(k),
+			Version: legacy[k],
+		}
+	}
+	return res, nil
+}
+
+// formatBillOfMaterials returns the BOM in the format written to output files.
+func formatBillOfMaterials(materials map[string]Material) string {
+	bs, _ := json.Marshal(bom{Schema: bomSchema, Materials: materials})
+	return string(bs)
 }
 
+// formatLegacyBillOfMaterials returns the BOM in the original format of a flat map of material names to versions.
+func formatLegacyBillOfMaterials(materials map[string]Material) string {
+	versions := make(map[string]string, len(materials))
+	for k := range materials {
+		versions[k] = materials[k].Version
+	}
+	bs, _ := json.Marshal(versions)
+	return string(bs)
+}
+
+// isLegacyBillOfMaterials determines whether the given materials were read from a BOM in the original format. Every
+// material in the current format has a resolution time, while those read from the original format have none.
+func isLegacyBillOfMaterials(materials map[string]Material) bool {
+	for k := range materials {
+		if materials[k].Resolved != nil {
+			return false
+		}
+	}
+	return len(materials) > 0
+}
+
+// materialType returns the type of material based on its name. Releases are recorded without a prefix; all other
+// materials are named "type:name".
+func materialType(name string) string {
+	if kind, _, found := strings.Cut(name, ":"); found {
+		return kind
+	}
+	return "release"
+}
+
+// carryResolutionTimes copies the resolution time from old materials to new ones if they were resolved to the same
+// version, so that the BOM doesn't change on every run. Materials that are new or changed are timestamped with now.
+func carryResolutionTimes(oldBom, newBom map[string]Material, now time.Time) {
+	for k := range newBom {
+		m := newBom[k]
+		if old, ok := oldBom[k]; ok && old.Resolved != nil && old.Version == m.Version && old.Digest == m.Digest {
+			m.Resolved = old.Resolved
+		} else {
+			resolved := now
+			m.Resolved = &resolved
+		}
+		newBom[k] = m
+	}
+}
+
+// ChangeKind classifies how a material changed between two BOMs.
+type ChangeKind string
+
+const (
+	// Added indicates a material that wasn't previously used.
+	Added ChangeKind = "added"
+	// Removed indicates a material that is no longer used.
+	Removed ChangeKind = "removed"
+	// Upgraded indicates a material whose version increased.
+	Upgraded ChangeKind = "upgraded"
+	// Downgraded indicates a material whose version decreased.
+	Downgraded ChangeKind = "downgraded"
+	// Changed indicates a material whose versions can't be ordered (e.g. image digests), or whose digest changed
+	// without a change in version.
+	Changed ChangeKind = "changed"
+)
+
 type Change struct {
-	Material string
-	Old      string
-	New      string
+	Material string     `json:"material"`
+	Kind     ChangeKind `json:"kind"`
+	// Bump is the most significant part of the version that changed, for upgrades and downgrades.
+	Bump VersionBump `json:"bump,omitempty"`
+	// Old is the previous state of the material, or nil if it wasn't previously used.
+	Old *Material `json:"old,omitempty"`
+	// New is the current state of the material, or nil if it is no longer used.
+	New *Material `json:"new,omitempty"`
+}
+
+// OldVersion returns the previous version of the material, or an empty string if it wasn't previously used.
+func (c Change) OldVersion() string {
+	if c.Old == nil {
+		return ""
+	}
+	return c.Old.Version
+}
+
+// NewVersion returns the current version of the material, or an empty string if it is no longer used.
+func (c Change) NewVersion() string {
+	if c.New == nil {
+		return ""
+	}
+	return c.New.Version
 }
 
-func diffMaterials(oldBom, newBom map[string]string) []Change {
+// diffMaterials returns all the changes between two BOMs, sorted by material name.
+func diffMaterials(oldBom, newBom map[string]Material) []Change {
 	var res []Change
 	for i := range newBom {
-		if oldBom[i] != newBom[i] {
-			res = append(res, Change{
-				Material: i,
-				Old:      oldBom[i],
-				New:      newBom[i],
-			})
+		newMaterial := newBom[i]
+		old, ok := oldBom[i]
+		if !ok {
+			res = append(res, Change{Material: i, Kind: Added, New: &newMaterial})
+		} else if old.Version != newMaterial.Version {
+			kind, bump := classifyVersionChange(newMaterial.Type, old.Version, newMaterial.Version)
+			res = append(res, Change{Material: i, Kind: kind, Bump: bump, Old: &old, New: &newMaterial})
+		} else if old.Digest != "" && old.Digest != newMaterial.Digest {
+			// Materials read from a legacy BOM have no digest, so only compare digests if both sides have one.
+			res = append(res, Change{Material: i, Kind: Changed, Old: &old, New: &newMaterial})
+		}
+	}
+
+	for i := range oldBom {
+		if _, ok := newBom[i]; !ok {
+			old := oldBom[i]
+			res = append(res, Change{Material: i, Kind: Removed, Old: &old})
 		}
 	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Material < res[j].Material
+	})
 	return res
 }
+
+// classifyVersionChange determines whether a change between two versions of a material is an upgrade or a downgrade,
+// and how significant it is. If either version can't be parsed, Changed is returned. Images are versioned by their
+// digest, which can't be ordered, so are always Changed.
+func classifyVersionChange(kind, oldVersion, newVersion string) (ChangeKind, VersionBump) {
+	if kind == "image" {
+		return Changed, ""
+	}
+
+	cmp, bump, ok := compareVersions(kind, oldVersion, newVersion)
+	if !ok || cmp == 0 {
+		return Changed, ""
+	} else if cmp < 0 {
+		return Upgraded, bump
+	}
+	return Downgraded, bump
+}
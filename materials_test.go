@@ -0,0 +1,138 @@
+package contempt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseBillOfMaterials(t *testing.T) {
+	resolved := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]Material
+		wantErr bool
+	}{
+		{
+			"Reads legacy BOMs",
+			`{"alpine":"3.19.1","apk:musl":"1.2.4-r2","image:alpine":"abcdef"}`,
+			map[string]Material{
+				"alpine":       {Type: "release", Version: "3.19.1"},
+				"apk:musl":     {Type: "apk", Version: "1.2.4-r2"},
+				"image:alpine": {Type: "image", Version: "abcdef"},
+			},
+			false,
+		},
+		{
+			"Reads empty legacy BOMs",
+			`{}`,
+			map[string]Material{},
+			false,
+		},
+		{
+			"Reads versioned BOMs",
+			`{"schema":2,"materials":{"apk:musl":{"type":"apk","version":"1.2.4-r2","digest":"sha1:abc","resolved":"2024-01-02T03:04:05Z"}}}`,
+			map[string]Material{
+				"apk:musl": {Type: "apk", Version: "1.2.4-r2", Digest: "sha1:abc", Resolved: &resolved},
+			},
+			false,
+		},
+		{
+			"Errors on invalid JSON",
+			`{"apk:musl":`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBillOfMaterials(tt.data)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_formatBillOfMaterials_roundTrips(t *testing.T) {
+	resolved := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	materials := map[string]Material{
+		"image:alpine": {Type: "image", Source: "reg.c5h.io/alpine", Version: "abc", Digest: "sha256:abc", Resolved: &resolved},
+	}
+
+	got, err := parseBillOfMaterials(formatBillOfMaterials(materials))
+	assert.NoError(t, err)
+	assert.Equal(t, materials, got)
+}
+
+func Test_carryResolutionTimes(t *testing.T) {
+	then := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	oldBom := map[string]Material{
+		"unchanged": {Version: "1", Digest: "sha256:1", Resolved: &then},
+		"upgraded":  {Version: "1", Resolved: &then},
+		"legacy":    {Version: "1"},
+	}
+	newBom := map[string]Material{
+		"unchanged": {Version: "1", Digest: "sha256:1"},
+		"upgraded":  {Version: "2"},
+		"legacy":    {Version: "1"},
+		"added":     {Version: "1"},
+	}
+
+	carryResolutionTimes(oldBom, newBom, now)
+
+	assert.Equal(t, &then, newBom["unchanged"].Resolved)
+	assert.Equal(t, &now, newBom["upgraded"].Resolved)
+	assert.Equal(t, &now, newBom["legacy"].Resolved)
+	assert.Equal(t, &now, newBom["added"].Resolved)
+}
+
+func Test_diffMaterials(t *testing.T) {
+	oldBom := map[string]Material{
+		"apk:removed":    {Type: "apk", Version: "1.0.0-r0"},
+		"apk:upgraded":   {Type: "apk", Version: "1.0.0"},
+		"apk:downgraded": {Type: "apk", Version: "1.2.0"},
+		"apk:unchanged":  {Type: "apk", Version: "1.0.0", Digest: "sha1:abc"},
+		"github:moved":   {Type: "github", Version: "v1.0.0", Digest: "sha1:abc"},
+		"apk:revised":    {Type: "apk", Version: "1.0.0-r9"},
+		"image:alpine":   {Type: "image", Version: "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d"},
+		"legacy":         {Type: "release", Version: "1.0.0"},
+	}
+	newBom := map[string]Material{
+		"apk:added":      {Type: "apk", Version: "2.0.0-r0"},
+		"apk:upgraded":   {Type: "apk", Version: "1.0.1"},
+		"apk:downgraded": {Type: "apk", Version: "1.1.9"},
+		"apk:unchanged":  {Type: "apk", Version: "1.0.0", Digest: "sha1:abc"},
+		"github:moved":   {Type: "github", Version: "v1.0.0", Digest: "sha1:def"},
+		"apk:revised":    {Type: "apk", Version: "1.0.0-r10"},
+		"image:alpine":   {Type: "image", Version: "18ac3e7343f016890c510e93f935261169d9e3f565436429830faf0934f4f8e4"},
+		"legacy":         {Type: "release", Version: "1.0.0", Digest: "sha256:abc"},
+	}
+
+	var got []string
+	for _, c := range diffMaterials(oldBom, newBom) {
+		got = append(got, fmt.Sprintf("%s %s %s->%s", c.Material, c.Kind, c.OldVersion(), c.NewVersion()))
+	}
+
+	assert.Equal(t, []string{
+		"apk:added added ->2.0.0-r0",
+		"apk:downgraded downgraded 1.2.0->1.1.9",
+		"apk:removed removed 1.0.0-r0->",
+		"apk:revised upgraded 1.0.0-r9->1.0.0-r10",
+		"apk:upgraded upgraded 1.0.0->1.0.1",
+		"github:moved changed v1.0.0->v1.0.0",
+		"image:alpine changed 3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d->18ac3e7343f016890c510e93f935261169d9e3f565436429830faf0934f4f8e4",
+	}, got)
+}
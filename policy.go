@@ -0,0 +1,153 @@
+package contempt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// policyName is the name of the file in the root of the input directory that restricts which materials may be used.
+const policyName = "policy.yaml"
+
+// Policy contains rules that restrict the materials a project may use.
+type Policy struct {
+	Deny []PolicyRule `yaml:"deny"`
+}
+
+// PolicyRule denies any materials whose names or licences match one of the given patterns. Patterns use the syntax
+// of path.Match, and licences are matched case-insensitively against each licence in an SPDX expression.
+type PolicyRule struct {
+	// Materials contains patterns of material names to deny, such as "apk:sudo".
+	Materials []string `yaml:"materials"`
+	// Licences contains patterns of licences to deny, such as "AGPL-*".
+	Licences []string `yaml:"licences"`
+	// Projects restricts the rule to projects matching one of the patterns. If empty, the rule applies to all.
+	Projects []string `yaml:"projects"`
+	// Except exempts projects matching any of the patterns from the rule.
+	Except []string `yaml:"except"`
+	// Reason is a human-readable explanation of the rule.
+	Reason string `yaml:"reason"`
+}
+
+// Violation describes a material that is not permitted by the policy.
+type Violation struct {
+	Material string `json:"material"`
+	// Licence is the licence that was denied, if the material was denied because of its licence.
+	Licence string `json:"licence,omitempty"`
+	// RequiredBy is the chain of materials that caused the denied material to be included.
+	RequiredBy []string `json:"required_by,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+func (v Violation) Error() string {
+	res := v.Material
+	if len(v.RequiredBy) > 0 {
+		res += fmt.Sprintf(" (required by %s)", strings.Join(v.RequiredBy, " -> "))
+	}
+	if v.Licence != "" {
+		res += fmt.Sprintf(" has denied licence %s", v.Licence)
+	} else {
+		res += " is denied"
+	}
+	if v.Reason != "" {
+		res += fmt.Sprintf(": %s", v.Reason)
+	}
+	return res
+}
+
+// readPolicy reads the policy from the root of the input directory. If there is no policy file, an empty policy is
+// returned.
+func readPolicy(inBase string) (*Policy, error) {
+	target := filepath.Join(inBase, policyName)
+	bs, err := os.ReadFile(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Policy{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(bs, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", target, err)
+	}
+	return policy, nil
+}
+
+// Check returns all the violations of the policy by the given project's materials.
+func (p *Policy) Check(project string, materials map[string]Material) []Violation {
+	var names []string
+	for name := range materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var res []Violation
+	for _, name := range names {
+		for _, rule := range p.Deny {
+			if !rule.appliesTo(project) {
+				continue
+			}
+
+			if v, ok := rule.check(name, materials[name]); ok {
+				res = append(res, v)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// appliesTo determines whether the rule should be evaluated for the given project.
+func (r PolicyRule) appliesTo(project string) bool {
+	return (len(r.Projects) == 0 || matchesAny(r.Projects, project)) && !matchesAny(r.Except, project)
+}
+
+// check determines whether the rule denies the given material.
+func (r PolicyRule) check(name string, material Material) (Violation, bool) {
+	v := Violation{Material: name, RequiredBy: material.RequiredBy, Reason: r.Reason}
+	if matchesAny(r.Materials, name) {
+		return v, true
+	}
+
+	for _, licence := range licenceIdentifiers(material.Licence) {
+		if matchesAny(r.Licences, licence) {
+			v.Licence = licence
+			return v, true
+		}
+	}
+
+	return Violation{}, false
+}
+
+// licenceIdentifiers splits an SPDX licence expression (e.g. "(MIT OR GPL-2.0-only) AND BSD-3-Clause") into the
+// individual licences it refers to.
+func licenceIdentifiers(expression string) []string {
+	var res []string
+	for _, field := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression)) {
+		switch strings.ToUpper(field) {
+		case "AND", "OR", "WITH":
+			continue
+		}
+		res = append(res, field)
+	}
+	return res
+}
+
+// matchesAny determines whether the value matches any of the patterns, ignoring case. Unlike path.Match, wildcards
+// also match "/", as material and project names (e.g. "image:tools/web") commonly contain them.
+func matchesAny(patterns []string, value string) bool {
+	// Swap slashes for a character that path.Match doesn't treat as a separator.
+	slashes := strings.NewReplacer("/", "\x00")
+	for i := range patterns {
+		if ok, _ := path.Match(slashes.Replace(strings.ToLower(patterns[i])), slashes.Replace(strings.ToLower(value))); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package contempt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy := &Policy{Deny: []PolicyRule{
+		{Materials: []string{"apk:sudo", "apk:doas*"}, Except: []string{"build-*"}, Reason: "no privilege escalation at runtime"},
+		{Licences: []string{"agpl-*"}},
+		{Materials: []string{"image:*"}, Projects: []string{"minimal", "tools/*"}},
+		{Materials: []string{"github:*"}, Projects: []string{"apps/*/web"}},
+	}}
+
+	materials := map[string]Material{
+		"apk:musl":                       {Type: "apk", Version: "1.2.4-r2", Licence: "MIT"},
+		"apk:sudo":                       {Type: "apk", Version: "1.9.15-r0", Licence: "custom ISC", RequiredBy: []string{"apk:admin-tools", "apk:helpers"}},
+		"apk:ghostscr":                   {Type: "apk", Version: "10.02-r0", Licence: "(MIT OR AGPL-3.0-or-later) AND BSD-3-Clause"},
+		"image:alpine":                   {Type: "image", Version: "abc"},
+		"image:docker.io/library/alpine": {Type: "image", Version: "abc"},
+		"image:tools/web":                {Type: "image", Version: "abc"},
+		"github:csmith/contempt":         {Type: "github", Version: "v1.0.0"},
+	}
+
+	tests := []struct {
+		name    string
+		project string
+		want    []Violation
+	}{
+		{
+			"Denies materials and licences",
+			"web",
+			[]Violation{
+				{Material: "apk:ghostscr", Licence: "AGPL-3.0-or-later"},
+				{Material: "apk:sudo", RequiredBy: []string{"apk:admin-tools", "apk:helpers"}, Reason: "no privilege escalation at runtime"},
+			},
+		},
+		{
+			"Honours exceptions",
+			"build-base",
+			[]Violation{
+				{Material: "apk:ghostscr", Licence: "AGPL-3.0-or-later"},
+			},
+		},
+		{
+			"Honours project restrictions",
+			"minimal",
+			[]Violation{
+				{Material: "apk:ghostscr", Licence: "AGPL-3.0-or-later"},
+				{Material: "apk:sudo", RequiredBy: []string{"apk:admin-tools", "apk:helpers"}, Reason: "no privilege escalation at runtime"},
+				{Material: "image:alpine"},
+				{Material: "image:docker.io/library/alpine"},
+				{Material: "image:tools/web"},
+			},
+		},
+		{
+			"Matches slashes in project names",
+			"tools/db",
+			[]Violation{
+				{Material: "apk:ghostscr", Licence: "AGPL-3.0-or-later"},
+				{Material: "apk:sudo", RequiredBy: []string{"apk:admin-tools", "apk:helpers"}, Reason: "no privilege escalation at runtime"},
+				{Material: "image:alpine"},
+				{Material: "image:docker.io/library/alpine"},
+				{Material: "image:tools/web"},
+			},
+		},
+		{
+			"Matches slashes in material names",
+			"apps/api/web",
+			[]Violation{
+				{Material: "apk:ghostscr", Licence: "AGPL-3.0-or-later"},
+				{Material: "apk:sudo", RequiredBy: []string{"apk:admin-tools", "apk:helpers"}, Reason: "no privilege escalation at runtime"},
+				{Material: "github:csmith/contempt"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Check(tt.project, materials))
+		})
+	}
+}
+
+func TestViolation_Error(t *testing.T) {
+	assert.Equal(t, "apk:sudo (required by apk:a -> apk:b) is denied: no sudo", Violation{Material: "apk:sudo", RequiredBy: []string{"apk:a", "apk:b"}, Reason: "no sudo"}.Error())
+	assert.Equal(t, "apk:foo has denied licence AGPL-3.0", Violation{Material: "apk:foo", Licence: "AGPL-3.0"}.Error())
+}
+
+func Test_readPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	policy, err := readPolicy(dir)
+	require.NoError(t, err)
+	assert.Empty(t, policy.Deny)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, policyName), []byte("deny:\n  - materials: [apk:sudo]\n    reason: nope\n"), 0600))
+	policy, err = readPolicy(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyRule{{Materials: []string{"apk:sudo"}, Reason: "nope"}}, policy.Deny)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, policyName), []byte("deny:\n  - package: sudo\n"), 0600))
+	_, err = readPolicy(dir)
+	assert.Error(t, err)
+}
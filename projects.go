@@ -3,33 +3,129 @@ package contempt
 import (
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"reflect"
-	"sort"
+	"regexp"
 	"strings"
 	"text/template"
+	"text/template/parse"
+
+	"github.com/csmith/contempt/internal"
+	"github.com/csmith/contempt/sources"
 )
 
+// projectNamePattern matches valid project names, which follow the rules for repository paths in image names.
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// Project describes a single image that can be generated from this repo.
+type Project struct {
+	// Name identifies the project. It is the path of the project's directory relative to the input directory, using
+	// forward slashes (e.g. "tools/web"), and is used as both the name of the image and of its output directory.
+	Name string
+	// Template is the path of the template, relative to the input directory.
+	Template string
+	// Extras are the paths of any other templates in the project, relative to the input directory.
+	Extras []string
+	// Values is the data passed to the template when it is executed.
+	Values map[string]interface{}
+	// Dependencies are the names of the other projects whose images this project uses.
+	Dependencies []string
+	// ExternalImages are the names of any images from outside this repo that the project uses.
+	ExternalImages []string
+	// Platforms are the platforms the project's image should be built for, if they have been overridden in its values.
+	Platforms []string
+	// Tags are templates for the tags the project's image should be pushed with, if they have been overridden in its
+	// values.
+	Tags []string
+}
+
+// OutputDir returns the directory the project's output is written to, within the given output directory.
+func (p Project) OutputDir(outBase string) string {
+	return filepath.Join(outBase, filepath.FromSlash(p.Name))
+}
+
 // FindProjects returns a slice of all images that can be built from this repo, sorted such that images are positioned
-// after all of their dependencies.
-func FindProjects(dir, templateName string) ([]string, error) {
+// after all of their dependencies. Shared templates in partialsDir are made available to every project.
+//
+// Projects that declare variants are expanded so that each variant is returned as its own project.
+func FindProjects(dir, templateName, partialsDir string) ([]Project, error) {
+	projects := make(map[string]Project)
 	deps := make(map[string][]string)
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if d.IsDir() && strings.HasPrefix(d.Name(), ".") {
+		if d.IsDir() && (strings.HasPrefix(d.Name(), ".") || file == partialsDir) {
 			return filepath.SkipDir
 		}
 
 		if d.Name() == templateName {
-			project := filepath.Dir(path)
+			project := filepath.Dir(file)
 			if _, err := os.Stat(filepath.Join(project, "IGNORE")); errors.Is(err, os.ErrNotExist) {
-				deps[filepath.Base(project)] = dependencies(project, templateName)
+				values, err := projectValues(dir, project)
+				if err != nil {
+					return err
+				}
+
+				template, err := filepath.Rel(dir, file)
+				if err != nil {
+					return err
+				}
+
+				extras, err := extraTemplates(dir, project, templateName)
+				if err != nil {
+					return err
+				}
+
+				variants, err := expandVariants(filepath.Base(project), values)
+				if err != nil {
+					return fmt.Errorf("invalid variants for %s: %v", template, err)
+				}
+
+				namespace := filepath.ToSlash(filepath.Dir(filepath.Dir(template)))
+				for i := range variants {
+					if namespace != "." {
+						variants[i].name = path.Join(namespace, variants[i].name)
+					}
+
+					if !projectNamePattern.MatchString(variants[i].name) {
+						return fmt.Errorf("invalid project name %q for %s: project names are used as image names, so must be lowercase and only contain letters, digits, separators and slashes (rename the directory, or add an IGNORE file to skip it)", variants[i].name, template)
+					}
+
+					if existing, ok := projects[variants[i].name]; ok {
+						return fmt.Errorf("duplicate project name %s: defined by %s and %s", variants[i].name, existing.Template, template)
+					}
+
+					platforms, err := projectPlatforms(variants[i].values)
+					if err != nil {
+						return fmt.Errorf("invalid platforms for %s: %v", template, err)
+					}
+
+					tags, err := stringListValue(variants[i].values, tagsKey)
+					if err != nil {
+						return fmt.Errorf("invalid tags for %s: %v", template, err)
+					}
+
+					projects[variants[i].name] = Project{
+						Name:      variants[i].name,
+						Template:  template,
+						Extras:    extras,
+						Values:    variants[i].values,
+						Platforms: platforms,
+						Tags:      tags,
+					}
+					p := projects[variants[i].name]
+					p.Dependencies, p.ExternalImages, err = dependencies(dir, p, partialsDir)
+					if err != nil {
+						return err
+					}
+					projects[variants[i].name] = p
+					deps[variants[i].name] = p.Dependencies
+				}
 			}
 		}
 		return nil
@@ -38,71 +134,238 @@ func FindProjects(dir, templateName string) ([]string, error) {
 		return nil, err
 	}
 
-	var res []string
-	satisfied := func(reqs []string) bool {
-		found := 0
-		for i := range reqs {
-			for j := range res {
-				if res[j] == reqs[i] {
-					found++
-					break
-				}
-			}
-		}
-		return found == len(reqs)
+	res, err := internal.TopologicalSort(deps)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve dependencies: %v", err)
 	}
 
-	for len(deps) > 0 {
-		var batch []string
-		for d := range deps {
-			if satisfied(deps[d]) {
-				batch = append(batch, d)
-				delete(deps, d)
-			}
-		}
-		if len(batch) == 0 {
-			return nil, fmt.Errorf("could not fully resolve dependencies: %#v", deps)
+	ordered := make([]Project, len(res))
+	for i := range res {
+		ordered[i] = projects[res[i]]
+	}
+	return ordered, nil
+}
+
+const (
+	// platformsKey is the key in a project's values that overrides the platforms its image is built for.
+	platformsKey = "platforms"
+	// tagsKey is the key in a project's values that overrides the tags its image is pushed with.
+	tagsKey = "tags"
+)
+
+// projectPlatforms returns the platforms declared in the given values, or nil if there aren't any.
+func projectPlatforms(values map[string]interface{}) ([]string, error) {
+	res, err := stringListValue(values, platformsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range res {
+		if !platformPattern.MatchString(res[i]) {
+			return nil, fmt.Errorf("invalid platform %s: must be in the form os/arch or os/arch/variant", res[i])
 		}
+	}
+	return res, nil
+}
+
+// stringListValue returns the non-empty list of strings with the given key in the values, or nil if the key isn't
+// present.
+func stringListValue(values map[string]interface{}, key string) ([]string, error) {
+	spec, ok := values[key]
+	if !ok {
+		return nil, nil
+	}
 
-		sort.Strings(batch)
-		res = append(res, batch...)
+	list, ok := spec.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s must be a non-empty list", key)
 	}
 
+	res := make([]string, len(list))
+	for i := range list {
+		str, ok := list[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must only contain strings, found %v", key, list[i])
+		}
+		res[i] = str
+	}
 	return res, nil
 }
 
-func dependencies(dir, templateName string) []string {
+// platformPattern matches platforms such as "linux/amd64" or "linux/arm/v7".
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(?:/[a-z0-9]+)?$`)
+
+// extraTemplates returns the paths, relative to base, of all templates in the project directory other than the main
+// template.
+func extraTemplates(base, dir, templateName string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.gotpl"))
+	if err != nil {
+		return nil, err
+	}
+
 	var res []string
-	fakeFunks := template.FuncMap{}
-	for f := range templateFuncs {
-		out := reflect.ValueOf(templateFuncs[f]).Type().Out(0).Kind()
-		if f == "image" {
-			fakeFunks[f] = func(dep string) string {
-				// Ignore fully-qualified images like "docker.io/library/alpine"
-				if index := strings.IndexByte(dep, '.'); index == -1 || index > strings.IndexByte(dep, '/') {
-					res = append(res, dep)
-				}
-				return ""
-			}
-		} else if out == reflect.Map {
-			fakeFunks[f] = func(args ...string) map[string]string {
-				return nil
-			}
-		} else if out == reflect.Slice {
-			fakeFunks[f] = func(args ...string) []string {
-				return nil
-			}
+	for i := range matches {
+		if filepath.Base(matches[i]) == templateName {
+			continue
+		}
+
+		rel, err := filepath.Rel(base, matches[i])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rel)
+	}
+	return res, nil
+}
+
+// imageFuncs contains the names of template functions whose first argument is an image reference.
+var imageFuncs = map[string]bool{
+	"image": true,
+}
+
+// dependencies returns the names of the projects and external images that the given project depends on, found by
+// walking the parse trees of its templates (and any templates they invoke) for calls to image functions. Calls with
+// non-constant arguments can't be resolved, so a warning is logged for them.
+func dependencies(base string, project Project, partialsDir string) ([]string, []string, error) {
+	paths := []string{filepath.Join(base, project.Template)}
+	for i := range project.Extras {
+		paths = append(paths, filepath.Join(base, project.Extras[i]))
+	}
+
+	tpl, err := parseTemplate(paths, partialsDir, templateFuncs(make(map[string]Material)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse template file %s: %v", paths[0], err)
+	}
+
+	w := &dependencyWalker{
+		project: project.Name,
+		tpl:     tpl,
+		visited: make(map[string]bool),
+		seen:    make(map[string]bool),
+	}
+	for i := range paths {
+		w.walkTemplate(filepath.Base(paths[i]))
+	}
+	return w.deps, w.external, nil
+}
+
+// dependencyWalker collects image references from template parse trees.
+type dependencyWalker struct {
+	project  string
+	tpl      *template.Template
+	tree     *parse.Tree
+	visited  map[string]bool
+	seen     map[string]bool
+	deps     []string
+	external []string
+}
+
+// walkTemplate walks the named template, if it exists and hasn't already been visited.
+func (w *dependencyWalker) walkTemplate(name string) {
+	t := w.tpl.Lookup(name)
+	if t == nil || t.Tree == nil || w.visited[name] {
+		return
+	}
+
+	w.visited[name] = true
+	previous := w.tree
+	w.tree = t.Tree
+	w.walk(t.Tree.Root)
+	w.tree = previous
+}
+
+func (w *dependencyWalker) walk(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for i := range n.Nodes {
+			w.walk(n.Nodes[i])
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe)
+	case *parse.IfNode:
+		w.walkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		w.walkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		w.walkBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe)
+		w.walkTemplate(n.Name)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for i := range n.Cmds {
+			w.walkCommand(n, i)
+		}
+	case *parse.ChainNode:
+		w.walk(n.Node)
+	}
+}
+
+func (w *dependencyWalker) walkBranch(n *parse.BranchNode) {
+	w.walk(n.Pipe)
+	w.walk(n.List)
+	w.walk(n.ElseList)
+}
+
+// walkCommand checks whether the i-th command in the pipeline calls an image function, and walks its arguments.
+func (w *dependencyWalker) walkCommand(pipe *parse.PipeNode, i int) {
+	cmd := pipe.Cmds[i]
+	for j := range cmd.Args {
+		w.walk(cmd.Args[j])
+	}
+
+	if len(cmd.Args) == 0 {
+		return
+	}
+
+	identifier, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || !imageFuncs[identifier.Ident] {
+		return
+	}
+
+	var arg parse.Node
+	if len(cmd.Args) > 1 {
+		arg = cmd.Args[1]
+	} else if i > 0 && len(pipe.Cmds[i-1].Args) == 1 {
+		// The argument is piped in from the previous command, e.g. {{"alpine" | image}}
+		arg = pipe.Cmds[i-1].Args[0]
+	}
+
+	if str, ok := arg.(*parse.StringNode); ok {
+		if dep, internal := projectDependency(str.Text); w.seen[dep] {
+			return
+		} else if internal {
+			w.seen[dep] = true
+			w.deps = append(w.deps, dep)
 		} else {
-			fakeFunks[f] = func(args ...string) string {
-				return ""
-			}
+			w.seen[dep] = true
+			w.external = append(w.external, dep)
 		}
+	} else {
+		location, _ := w.tree.ErrorContext(cmd)
+		log.Printf("Warning: %s: %s: unable to determine dependency from non-constant argument to %s", w.project, location, identifier.Ident)
+	}
+}
+
+// projectDependency returns the name of the image that an image reference refers to, with any tag or digest removed,
+// and whether it refers to a project. Fully-qualified images like "docker.io/library/alpine" are external unless they
+// are in the configured registry, so "reg.example.com/tools/web:latest" refers to the "tools/web" project.
+func projectDependency(ref string) (string, bool) {
+	name, _, _ := strings.Cut(ref, "@")
+	if index := strings.LastIndexByte(name, ':'); index > strings.LastIndexByte(name, '/') {
+		name = name[:index]
+	}
+
+	if project := strings.TrimPrefix(name, sources.Registry()+"/"); project != name {
+		return project, true
 	}
 
-	templatePath := filepath.Join(dir, templateName)
-	tpl := template.New(templatePath)
-	tpl.Funcs(fakeFunks)
-	_, _ = tpl.ParseFiles(templatePath)
-	_ = tpl.ExecuteTemplate(io.Discard, templateName, nil)
-	return res
+	// Fully-qualified images like "docker.io/library/alpine" are external.
+	index := strings.IndexByte(name, '.')
+	return name, index == -1 || index > strings.IndexByte(name, '/')
 }
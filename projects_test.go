@@ -0,0 +1,168 @@
+package contempt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProjectFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0700))
+		require.NoError(t, os.WriteFile(target, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestFindProjects_namespaces(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"base/Dockerfile.gotpl":          `FROM {{image "docker.io/library/alpine"}}`,
+		"apps/web/Dockerfile.gotpl":      `FROM {{image "tools/web"}}`,
+		"tools/web/Dockerfile.gotpl":     `FROM {{image "reg.c5h.io/base:latest"}}`,
+		"tools/db/Dockerfile.gotpl":      `FROM {{image "base"}}`,
+		"tools/db/values.yaml":           "variants:\n  matrix:\n    version: [15, 16]\n",
+		"_templates/common.gotpl":        `{{define "common"}}{{end}}`,
+		"ignored/thing/IGNORE":           "",
+		"ignored/thing/Dockerfile.gotpl": `FROM {{image "missing"}}`,
+	})
+
+	projects, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	require.NoError(t, err)
+
+	var names []string
+	for i := range projects {
+		names = append(names, projects[i].Name)
+	}
+	assert.Equal(t, []string{"base", "tools/db-15", "tools/db-16", "tools/web", "apps/web"}, names)
+	assert.Equal(t, filepath.Join("out", "tools", "web"), projects[3].OutputDir("out"))
+	assert.Equal(t, []string{"base"}, projects[3].Dependencies)
+	assert.Equal(t, []string{"docker.io/library/alpine"}, projects[0].ExternalImages)
+}
+
+func TestFindProjects_duplicateNames(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"tools/db-15/Dockerfile.gotpl": `FROM scratch`,
+		"tools/db/Dockerfile.gotpl":    `FROM scratch`,
+		"tools/db/values.yaml":         "variants:\n  matrix:\n    version: [15, 16]\n",
+	})
+
+	_, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	assert.ErrorContains(t, err, "duplicate project name tools/db-15")
+}
+
+func TestFindProjects_invalidNames(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"Tools/Web/Dockerfile.gotpl": `FROM scratch`,
+	})
+
+	_, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	assert.ErrorContains(t, err, `invalid project name "Tools/Web"`)
+	assert.ErrorContains(t, err, "rename the directory")
+}
+
+func Test_projectDependency(t *testing.T) {
+	tests := []struct {
+		ref    string
+		want   string
+		wantOk bool
+	}{
+		{"alpine", "alpine", true},
+		{"tools/web", "tools/web", true},
+		{"tools/web:latest", "tools/web", true},
+		{"tools/web@sha256:abc", "tools/web", true},
+		{"reg.c5h.io/tools/web", "tools/web", true},
+		{"reg.c5h.io:443/tools/web", "reg.c5h.io:443/tools/web", false},
+		{"docker.io/library/alpine:3.19", "docker.io/library/alpine", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, ok := projectDependency(tt.ref)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func Test_dependencies(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"_templates/base.gotpl": `{{define "base"}}FROM {{image "shared"}}{{end}}{{define "unused"}}{{image "unused"}}{{end}}`,
+		"app/Dockerfile.gotpl": `{{if .debug}}FROM {{image "debug"}}{{else}}{{template "base"}}{{end}}
+{{range .extras}}{{image .}}{{end}}
+{{with "piped" | image}}{{.}}{{end}}
+COPY --from={{image (printf "%s" "dynamic")}} / /
+FROM {{image "docker.io/library/alpine"}}`,
+		"app/extra.sh.gotpl": `{{image "tools/web:latest"}}`,
+	})
+
+	deps, external, err := dependencies(dir, Project{
+		Name:     "app",
+		Template: filepath.Join("app", "Dockerfile.gotpl"),
+		Extras:   []string{filepath.Join("app", "extra.sh.gotpl")},
+	}, filepath.Join(dir, "_templates"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debug", "shared", "piped", "tools/web"}, deps)
+	assert.Equal(t, []string{"docker.io/library/alpine"}, external)
+}
+
+func Test_dependencies_parseErrors(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"app/Dockerfile.gotpl": `FROM {{image "alpine"}`,
+	})
+
+	_, _, err := dependencies(dir, Project{Name: "app", Template: filepath.Join("app", "Dockerfile.gotpl")}, filepath.Join(dir, "_templates"))
+	assert.Error(t, err)
+}
+
+func TestFindProjects_dependencyErrors(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"a/Dockerfile.gotpl": `FROM {{image "b"}}`,
+		"b/Dockerfile.gotpl": `FROM {{image "a"}}`,
+		"c/Dockerfile.gotpl": `FROM {{image "nope"}}`,
+	})
+
+	_, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	assert.EqualError(t, err, "could not resolve dependencies: unknown dependencies (c needs nope) and dependency cycle (a → b → a)")
+}
+
+func TestFindProjects_platformsAndTags(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"base/Dockerfile.gotpl": `FROM scratch`,
+		"base/values.yaml":      "platforms: [linux/amd64, linux/arm/v7]\ntags: ['{{.Date}}']\n",
+		"web/Dockerfile.gotpl":  `FROM scratch`,
+	})
+
+	projects, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm/v7"}, projects[0].Platforms)
+	assert.Equal(t, []string{"{{.Date}}"}, projects[0].Tags)
+	assert.Nil(t, projects[1].Platforms)
+	assert.Nil(t, projects[1].Tags)
+}
+
+func TestFindProjects_invalidPlatforms(t *testing.T) {
+	for _, values := range []string{"platforms: linux/amd64\n", "platforms: []\n", "platforms: [amd64]\n"} {
+		dir := writeProjectFiles(t, map[string]string{
+			"base/Dockerfile.gotpl": `FROM scratch`,
+			"base/values.yaml":      values,
+		})
+
+		_, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+		assert.ErrorContains(t, err, "invalid platforms", values)
+	}
+}
+
+func TestFindProjects_invalidTags(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"base/Dockerfile.gotpl": `FROM scratch`,
+		"base/values.yaml":      "tags: [[nested]]\n",
+	})
+
+	_, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+	assert.ErrorContains(t, err, "invalid tags")
+}
@@ -0,0 +1,351 @@
+package contempt
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/csmith/contempt/sources"
+)
+
+const (
+	// CycloneDXName is the name of the file CycloneDX SBOMs are written to.
+	CycloneDXName = "sbom.cdx.json"
+	// SPDXName is the name of the file SPDX SBOMs are written to.
+	SPDXName = "sbom.spdx.json"
+)
+
+// component is a single material expressed in a form suitable for inclusion in an SBOM.
+type component struct {
+	kind     string
+	name     string
+	version  string
+	purl     string
+	licence  string
+	sha256   string
+	location string
+}
+
+// WriteSBOMs writes CycloneDX and SPDX documents describing the given materials (such as Result.Materials) into
+// outDir. The names of the files written are returned.
+func WriteSBOMs(sourceLink, project, outDir string, materials map[string]Material) ([]string, error) {
+	var keys []string
+	for k := range materials {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	components := make([]component, len(keys))
+	for i := range keys {
+		components[i] = materialComponent(keys[i], materials[keys[i]])
+	}
+
+	namespace := fmt.Sprintf("%s%s/%x", sourceLink, project, sha256.Sum256([]byte(formatBillOfMaterials(materials))))
+
+	cdx, err := json.MarshalIndent(cycloneDX(project, components), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	spdx, err := json.MarshalIndent(spdxDocument(project, namespace, time.Now().UTC(), components), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, CycloneDXName), cdx, os.FileMode(0644)); err != nil {
+		return nil, fmt.Errorf("unable to write CycloneDX SBOM: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, SPDXName), spdx, os.FileMode(0644)); err != nil {
+		return nil, fmt.Errorf("unable to write SPDX SBOM: %v", err)
+	}
+
+	return []string{CycloneDXName, SPDXName}, nil
+}
+
+// materialComponent converts a single BOM entry into a component, working out its purl and including any other
+// information that the source of the material recorded.
+func materialComponent(key string, material Material) component {
+	name := key
+	if _, suffix, found := strings.Cut(key, ":"); found {
+		name = suffix
+	}
+
+	c := component{
+		name:    name,
+		version: material.Version,
+		licence: material.Licence,
+	}
+
+	if strings.HasPrefix(material.Digest, "sha256:") {
+		c.sha256 = strings.TrimPrefix(material.Digest, "sha256:")
+	}
+
+	switch material.Type {
+	case "release":
+		c.kind = "application"
+		c.purl = fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(name), url.PathEscape(material.Version))
+		c.location = material.Source
+		if c.location != "" {
+			c.purl += fmt.Sprintf("?download_url=%s", url.QueryEscape(c.location))
+		}
+	case "apk":
+		c.kind = "library"
+		c.purl = fmt.Sprintf("pkg:apk/alpine/%s@%s", url.PathEscape(name), url.PathEscape(material.Version))
+	case "image":
+		repo := material.Source
+		if repo == "" {
+			repo = sources.ImageName(name)
+		}
+		var tag string
+		if i := strings.LastIndexByte(repo, ':'); i > strings.LastIndexByte(repo, '/') {
+			repo, tag = repo[:i], repo[i+1:]
+		}
+
+		c.kind = "container"
+		c.version = "sha256:" + material.Version
+		c.sha256 = material.Version
+		c.purl = fmt.Sprintf(
+			"pkg:oci/%s@%s?repository_url=%s",
+			url.PathEscape(strings.ToLower(repo[strings.LastIndexByte(repo, '/')+1:])),
+			url.PathEscape(c.version),
+			url.QueryEscape(repo),
+		)
+		if tag != "" {
+			c.purl += fmt.Sprintf("&tag=%s", url.QueryEscape(tag))
+		}
+	case "github":
+		c.kind = "library"
+		c.purl = fmt.Sprintf("pkg:github/%s@%s", strings.ToLower(name), url.PathEscape(material.Version))
+		c.location = fmt.Sprintf("git+https://github.com/%s@%s", name, material.Version)
+	case "git":
+		c.kind = "library"
+		c.purl = fmt.Sprintf(
+			"pkg:generic/%s@%s?vcs_url=%s",
+			url.PathEscape(strings.TrimSuffix(name[strings.LastIndexByte(name, '/')+1:], ".git")),
+			url.PathEscape(material.Version),
+			url.QueryEscape("git+"+name),
+		)
+		c.location = fmt.Sprintf("git+%s@%s", name, material.Version)
+	default:
+		c.kind = "data"
+		c.purl = fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(name), url.PathEscape(material.Version))
+		c.location = material.Source
+	}
+
+	return c
+}
+
+type cdxDocument struct {
+	BOMFormat   string         `json:"bomFormat"`
+	SpecVersion string         `json:"specVersion"`
+	Version     int            `json:"version"`
+	Metadata    cdxMetadata    `json:"metadata"`
+	Components  []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type     string       `json:"type"`
+	BOMRef   string       `json:"bom-ref,omitempty"`
+	Name     string       `json:"name"`
+	Version  string       `json:"version,omitempty"`
+	PURL     string       `json:"purl,omitempty"`
+	Licenses []cdxLicense `json:"licenses,omitempty"`
+	Hashes   []cdxHash    `json:"hashes,omitempty"`
+}
+
+// cdxLicense is either a named licence, or an SPDX licence expression.
+type cdxLicense struct {
+	License    *cdxNamedLicense `json:"license,omitempty"`
+	Expression string           `json:"expression,omitempty"`
+}
+
+type cdxNamedLicense struct {
+	Name string `json:"name"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// cycloneDX builds a CycloneDX 1.5 document describing the given project.
+func cycloneDX(project string, components []component) cdxDocument {
+	doc := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Tools: cdxTools{Components: []cdxComponent{{Type: "application", Name: "contempt"}}},
+			Component: cdxComponent{
+				Type:   "container",
+				BOMRef: project,
+				Name:   project,
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for i := range components {
+		c := cdxComponent{
+			Type:    components[i].kind,
+			BOMRef:  components[i].purl,
+			Name:    components[i].name,
+			Version: components[i].version,
+			PURL:    components[i].purl,
+		}
+		switch {
+		case components[i].licence == "":
+		case isCustomLicence(components[i].licence):
+			c.Licenses = []cdxLicense{{License: &cdxNamedLicense{Name: components[i].licence}}}
+		default:
+			c.Licenses = []cdxLicense{{Expression: components[i].licence}}
+		}
+		if components[i].sha256 != "" {
+			c.Hashes = []cdxHash{{Alg: "SHA-256", Content: components[i].sha256}}
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	return doc
+}
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxDocument builds an SPDX 2.3 document describing the given project.
+func spdxDocument(project, namespace string, created time.Time, components []component) spdxDoc {
+	const rootID = "SPDXRef-Image"
+
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              project,
+		DocumentNamespace: namespace,
+		CreationInfo: spdxCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: contempt"},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           rootID,
+			Name:             project,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: rootID,
+		}},
+	}
+
+	for i := range components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		p := spdxPackage{
+			SPDXID:           id,
+			Name:             components[i].name,
+			VersionInfo:      components[i].version,
+			DownloadLocation: orNoAssertion(components[i].location),
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  components[i].purl,
+			}},
+		}
+		if !isCustomLicence(components[i].licence) {
+			p.LicenseDeclared = orNoAssertion(components[i].licence)
+		}
+		if components[i].sha256 != "" {
+			p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: components[i].sha256}}
+		}
+
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      rootID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
+
+// isCustomLicence determines whether the given licence refers to a custom licence, such as Alpine's "custom" or
+// "custom:name" licences, which can't be used in SPDX licence expressions.
+func isCustomLicence(licence string) bool {
+	for _, term := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(licence)) {
+		if term == "custom" || strings.HasPrefix(term, "custom:") {
+			return true
+		}
+	}
+	return false
+}
+
+// orNoAssertion returns the given value, or the SPDX "NOASSERTION" placeholder if it is empty.
+func orNoAssertion(value string) string {
+	if value == "" {
+		return "NOASSERTION"
+	}
+	return value
+}
@@ -0,0 +1,149 @@
+package contempt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_materialComponent(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		material Material
+		want     component
+	}{
+		{
+			"Release",
+			"golang",
+			Material{Type: "release", Source: "https://golang.org/dl/go1.22.1.src.tar.gz", Version: "go1.22.1", Digest: "sha256:abcdef"},
+			component{
+				kind:     "application",
+				name:     "golang",
+				version:  "go1.22.1",
+				purl:     "pkg:generic/golang@go1.22.1?download_url=https%3A%2F%2Fgolang.org%2Fdl%2Fgo1.22.1.src.tar.gz",
+				sha256:   "abcdef",
+				location: "https://golang.org/dl/go1.22.1.src.tar.gz",
+			},
+		},
+		{
+			"Alpine package",
+			"apk:musl",
+			Material{Type: "apk", Version: "1.2.4-r2", Digest: "sha1:abcdef", Licence: "MIT"},
+			component{kind: "library", name: "musl", version: "1.2.4-r2", purl: "pkg:apk/alpine/musl@1.2.4-r2", licence: "MIT"},
+		},
+		{
+			"Image migrated from a legacy BOM",
+			"image:alpine",
+			Material{Type: "image", Version: "abcdef"},
+			component{
+				kind:    "container",
+				name:    "alpine",
+				version: "sha256:abcdef",
+				purl:    "pkg:oci/alpine@sha256:abcdef?repository_url=reg.c5h.io%2Falpine",
+				sha256:  "abcdef",
+			},
+		},
+		{
+			"Image with a tag on a registry with a port",
+			"image:example.com:5000/library/Hello-World:latest",
+			Material{Type: "image", Source: "example.com:5000/library/Hello-World:latest", Version: "abcdef", Digest: "sha256:abcdef"},
+			component{
+				kind:    "container",
+				name:    "example.com:5000/library/Hello-World:latest",
+				version: "sha256:abcdef",
+				purl:    "pkg:oci/hello-world@sha256:abcdef?repository_url=example.com%3A5000%2Flibrary%2FHello-World&tag=latest",
+				sha256:  "abcdef",
+			},
+		},
+		{
+			"GitHub repository",
+			"github:csmith/Contempt",
+			Material{Type: "github", Source: "https://github.com/csmith/Contempt", Version: "v1.8.1", Digest: "sha1:abcdef"},
+			component{
+				kind:     "library",
+				name:     "csmith/Contempt",
+				version:  "v1.8.1",
+				purl:     "pkg:github/csmith/contempt@v1.8.1",
+				location: "git+https://github.com/csmith/Contempt@v1.8.1",
+			},
+		},
+		{
+			"Git repository",
+			"git:https://git.sr.ht/~csmith/example.git",
+			Material{Type: "git", Source: "https://git.sr.ht/~csmith/example.git", Version: "v1.0.0"},
+			component{
+				kind:     "library",
+				name:     "https://git.sr.ht/~csmith/example.git",
+				version:  "v1.0.0",
+				purl:     "pkg:generic/example@v1.0.0?vcs_url=git%2Bhttps%3A%2F%2Fgit.sr.ht%2F~csmith%2Fexample.git",
+				location: "git+https://git.sr.ht/~csmith/example.git@v1.0.0",
+			},
+		},
+		{
+			"Other typed material",
+			"regexurl:google_button",
+			Material{Type: "regexurl", Source: "https://www.google.com/", Version: "Lucky"},
+			component{
+				kind:     "data",
+				name:     "google_button",
+				version:  "Lucky",
+				purl:     "pkg:generic/google_button@Lucky",
+				location: "https://www.google.com/",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, materialComponent(tt.key, tt.material))
+		})
+	}
+}
+
+func Test_sbomLicences(t *testing.T) {
+	tests := []struct {
+		licence  string
+		wantCDX  []cdxLicense
+		wantSPDX string
+	}{
+		{"", nil, "NOASSERTION"},
+		{"MIT", []cdxLicense{{Expression: "MIT"}}, "MIT"},
+		{"MIT OR Apache-2.0", []cdxLicense{{Expression: "MIT OR Apache-2.0"}}, "MIT OR Apache-2.0"},
+		{"custom", []cdxLicense{{License: &cdxNamedLicense{Name: "custom"}}}, "NOASSERTION"},
+		{"custom:bsd0", []cdxLicense{{License: &cdxNamedLicense{Name: "custom:bsd0"}}}, "NOASSERTION"},
+		{"MIT AND (custom OR BSD-3-Clause)", []cdxLicense{{License: &cdxNamedLicense{Name: "MIT AND (custom OR BSD-3-Clause)"}}}, "NOASSERTION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.licence, func(t *testing.T) {
+			components := []component{{kind: "library", name: "musl", purl: "pkg:apk/alpine/musl@1", licence: tt.licence}}
+			assert.Equal(t, tt.wantCDX, cycloneDX("web", components).Components[0].Licenses)
+			assert.Equal(t, tt.wantSPDX, spdxDocument("web", "ns", time.Time{}, components).Packages[1].LicenseDeclared)
+		})
+	}
+}
+
+func TestWriteSBOMs(t *testing.T) {
+	dir := t.TempDir()
+	materials := map[string]Material{
+		"apk:musl": {Type: "apk", Version: "1.2.4-r2", Digest: "sha256:abcdef", Licence: "MIT"},
+	}
+
+	files, err := WriteSBOMs("https://example.com/", "web", dir, materials)
+	require.NoError(t, err)
+	assert.Equal(t, []string{CycloneDXName, SPDXName}, files)
+
+	cdx, err := os.ReadFile(filepath.Join(dir, CycloneDXName))
+	require.NoError(t, err)
+	assert.Contains(t, string(cdx), `"expression": "MIT"`)
+	assert.Contains(t, string(cdx), `"content": "abcdef"`)
+
+	spdx, err := os.ReadFile(filepath.Join(dir, SPDXName))
+	require.NoError(t, err)
+	assert.Contains(t, string(spdx), `"licenseDeclared": "MIT"`)
+}
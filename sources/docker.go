@@ -1,12 +1,19 @@
 package sources
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
 var (
@@ -18,27 +25,130 @@ var (
 // LatestDigest finds the latest digest for the given image reference.
 // If either the username or password is blank, falls back to using the default docker keychain.
 func LatestDigest(ref string) (string, string, error) {
-	var authOpt crane.Option
+	image := ImageName(ref)
+	digest, err := crane.Digest(image, authOption())
+	return image, digest, err
+}
 
-	if *registryUser == "" || *registryPass == "" {
-		authOpt = crane.WithAuthFromKeychain(authn.DefaultKeychain)
-	} else {
-		authOpt = crane.WithAuth(&authn.Basic{
-			Username: *registryUser,
-			Password: *registryPass,
-		})
+// PlatformDigests returns the digest of each platform-specific image in the given image's manifest list, keyed by
+// platform (e.g. "linux/arm64"). If the image isn't a manifest list, an empty map is returned.
+func PlatformDigests(ref string) (map[string]string, error) {
+	manifest, err := crane.Manifest(ImageName(ref), authOption())
+	if err != nil {
+		return nil, err
 	}
 
-	// If the ref is fully-qualified (i.e., "example.com/image") then don't prepend the registry.
-	var image string
-	if index := strings.IndexByte(ref, '.'); index != -1 && index < strings.IndexByte(ref, '/') {
-		image = ref
-	} else {
-		image = fmt.Sprintf("%s/%s", *registry, ref)
+	index, err := v1.ParseIndexManifest(bytes.NewReader(manifest))
+	if err != nil {
+		return nil, err
 	}
 
-	digest, err := crane.Digest(image, authOpt)
-	return image, digest, err
+	res := make(map[string]string)
+	for _, m := range index.Manifests {
+		// Attestations are stored alongside the images with an "unknown/unknown" platform, so skip them.
+		if m.Platform != nil && m.Platform.OS != "unknown" {
+			res[m.Platform.String()] = m.Digest.String()
+		}
+	}
+	return res, nil
+}
+
+// TagImage adds the given tags to the image with the given digest in the registry. See applyTags for how failures
+// are handled.
+func TagImage(image, digest string, tags ...string) error {
+	ref, err := name.NewDigest(fmt.Sprintf("%s@%s", image, digest))
+	if err != nil {
+		return fmt.Errorf("invalid image reference %s@%s: %v", image, digest, err)
+	}
+
+	desc, err := remote.Get(ref, remoteAuthOption())
+	if err != nil {
+		return err
+	}
+
+	return applyTags(ref.Context(), desc, remoteAuthOption(), tags...)
+}
+
+// applyTags points each of the given tags in the repository at the given image. Every tag is validated, and its
+// current image looked up, before any are written. If writing a tag fails, any tags that have already been moved are
+// pointed back at their previous images; tags that didn't previously exist are left in place, as deleting a tag
+// deletes the image it refers to in many registries.
+func applyTags(repo name.Repository, image remote.Taggable, option remote.Option, tags ...string) error {
+	refs := make([]name.Tag, len(tags))
+	for i := range tags {
+		ref, err := name.NewTag(fmt.Sprintf("%s:%s", repo, tags[i]))
+		if err != nil {
+			return fmt.Errorf("invalid tag %s: %v", tags[i], err)
+		}
+		refs[i] = ref
+	}
+
+	previous := make([]*remote.Descriptor, len(refs))
+	for i := range refs {
+		desc, err := remote.Get(refs[i], option)
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to check existing tag %s: %v", refs[i], err)
+		}
+		previous[i] = desc
+	}
+
+	for i := range refs {
+		if err := remote.Tag(refs[i], image, option); err != nil {
+			message := fmt.Sprintf("unable to tag %s as %s: %v", repo, tags[i], err)
+			for j := 0; j < i; j++ {
+				if previous[j] == nil {
+					message += fmt.Sprintf("; new tag %s was left in place", tags[j])
+				} else if err := remote.Tag(refs[j], previous[j], option); err != nil {
+					message += fmt.Sprintf("; unable to restore tag %s: %v", tags[j], err)
+				}
+			}
+			return errors.New(message)
+		}
+	}
+	return nil
+}
+
+// authOption returns the credentials to use when querying registries. If either the username or password is blank,
+// the default docker keychain is used.
+func authOption() crane.Option {
+	return func(o *crane.Options) {
+		o.Remote = append(o.Remote, remoteAuthOption())
+	}
+}
+
+// remoteAuthOption is the equivalent of authOption for use with the remote package.
+func remoteAuthOption() remote.Option {
+	return Credentials{Username: *registryUser, Password: *registryPass}.remoteOption()
+}
+
+// Credentials are used to authenticate to a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// remoteOption returns an option that authenticates using the credentials. If either the username or password is
+// blank, the default docker keychain is used instead.
+func (c Credentials) remoteOption() remote.Option {
+	if c.Username == "" || c.Password == "" {
+		return remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	}
+	return remote.WithAuth(&authn.Basic{
+		Username: c.Username,
+		Password: c.Password,
+	})
+}
+
+// ImageName returns the fully-qualified name of the given image reference. If the ref is already fully-qualified
+// (i.e., "example.com/image") it is returned as-is, otherwise the configured registry is prepended.
+func ImageName(ref string) string {
+	if index := strings.IndexByte(ref, '.'); index != -1 && index < strings.IndexByte(ref, '/') {
+		return ref
+	}
+	return fmt.Sprintf("%s/%s", *registry, ref)
 }
 
 func Registry() string {
@@ -0,0 +1,75 @@
+package sources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushRandomImage pushes a new random image to the given reference, returning its digest.
+func pushRandomImage(t *testing.T, ref string) string {
+	image, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(image, ref))
+
+	digest, err := image.Digest()
+	require.NoError(t, err)
+	return digest.String()
+}
+
+func TestTagImage(t *testing.T) {
+	reg := testRegistry(t)
+	digest := pushRandomImage(t, reg+"/tools/web:build")
+
+	require.NoError(t, TagImage(reg+"/tools/web", digest, "1", "1.2"))
+
+	for _, tag := range []string{"1", "1.2"} {
+		tagged, err := crane.Digest(reg + "/tools/web:" + tag)
+		require.NoError(t, err)
+		assert.Equal(t, digest, tagged)
+	}
+}
+
+func TestTagImage_invalidTag(t *testing.T) {
+	reg := testRegistry(t)
+	digest := pushRandomImage(t, reg+"/tools/web:build")
+
+	assert.ErrorContains(t, TagImage(reg+"/tools/web", digest, "valid", "not valid!"), "invalid tag not valid!")
+
+	_, err := crane.Digest(reg + "/tools/web:valid")
+	assert.Error(t, err, "no tags should be written if any are invalid")
+}
+
+func TestTagImage_partialFailure(t *testing.T) {
+	registry := ggcrregistry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/broken") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	reg := strings.TrimPrefix(server.URL, "http://")
+
+	stable := pushRandomImage(t, reg+"/tools/web:stable")
+	digest := pushRandomImage(t, reg+"/tools/web:build")
+
+	err := TagImage(reg+"/tools/web", digest, "stable", "new", "broken")
+	assert.ErrorContains(t, err, "unable to tag")
+	assert.ErrorContains(t, err, "new tag new was left in place")
+
+	restored, err := crane.Digest(reg + "/tools/web:stable")
+	require.NoError(t, err)
+	assert.Equal(t, stable, restored, "existing tags should be restored")
+
+	_, err = crane.Digest(reg + "/tools/web:broken")
+	assert.Error(t, err)
+}
@@ -4,12 +4,14 @@ import (
 	"archive/tar"
 	"bufio"
 	"compress/gzip"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 var alpineMirror = flag.String("alpine-mirror", "https://dl-cdn.alpinelinux.org/alpine/", "Base URL of the Alpine mirror to use to query version and package info")
@@ -19,48 +21,125 @@ const apkIndexPath = "latest-stable/%s/x86_64/APKINDEX.tar.gz"
 // LatestAlpinePackages returns a map of packages to their latest version. The result will include all the provided
 // package names, plus all of their direct and transitive dependencies.
 func LatestAlpinePackages(names ...string) (map[string]string, error) {
+	res, _, err := ResolveAlpinePackages(names...)
+	return res, err
+}
+
+// ResolveAlpinePackages behaves like LatestAlpinePackages, but also returns a map of each transitive dependency to
+// the package that first required it. Packages that were requested directly are not included in the second map.
+func ResolveAlpinePackages(names ...string) (map[string]string, map[string]string, error) {
 	packages, err := apkPackageInfos()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	type requirement struct {
+		name   string
+		parent string
 	}
 
 	res := make(map[string]string)
-	queue := append([]string{}, names...)
+	parents := make(map[string]string)
+	var queue []requirement
+	for i := range names {
+		queue = append(queue, requirement{name: names[i]})
+	}
 
 	for len(queue) > 0 {
-		if _, ok := res[queue[0]]; ok {
+		if _, ok := res[queue[0].name]; ok {
 			// We've already got a resolution for this package, skip it.
 			queue = queue[1:]
 			continue
 		}
 
-		if strings.HasPrefix(queue[0], "!") {
+		if strings.HasPrefix(queue[0].name, "!") {
 			//Package conflict, skip it
 			queue = queue[1:]
 			continue
 		}
 
-		p, ok := packages[queue[0]]
+		p, ok := packages[queue[0].name]
 		if !ok {
-			return nil, fmt.Errorf("package required but not found: %s", queue[0])
+			return nil, nil, fmt.Errorf("package required but not found: %s", queue[0].name)
+		}
+
+		if _, ok := res[p.Name]; !ok {
+			res[p.Name] = p.Version
+			if queue[0].parent != "" {
+				parents[p.Name] = queue[0].parent
+			}
 		}
 
-		queue = append(queue[1:], p.Dependencies...)
-		res[p.Name] = p.Version
+		queue = queue[1:]
+		for i := range p.Dependencies {
+			queue = append(queue, requirement{name: p.Dependencies[i], parent: p.Name})
+		}
 	}
 
-	return res, nil
+	return res, parents, nil
 }
 
-var apkPackageCache map[string]*packageInfo
+// AlpinePackage contains details about the latest version of an Alpine package.
+type AlpinePackage struct {
+	Name       string
+	Version    string
+	Licence    string
+	Checksum   string
+	Repository string
+}
 
-// apkPackageInfos returns a map of all apk packages and their latest info.
+// LatestAlpinePackage returns details about the latest version of the given package.
+func LatestAlpinePackage(name string) (*AlpinePackage, error) {
+	packages, err := apkPackageInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := packages[name]
+	if !ok {
+		return nil, fmt.Errorf("package not found: %s", name)
+	}
+
+	return &AlpinePackage{
+		Name:       p.Name,
+		Version:    p.Version,
+		Licence:    p.Licence,
+		Checksum:   apkChecksum(p.Checksum),
+		Repository: p.Repository,
+	}, nil
+}
+
+// apkChecksum converts a checksum from an APKINDEX (a base64-encoded SHA-1 hash prefixed with "Q1") into a hex string
+// prefixed with the algorithm. If the checksum isn't in the expected format, an empty string is returned.
+func apkChecksum(checksum string) string {
+	if !strings.HasPrefix(checksum, "Q1") {
+		return ""
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(checksum, "Q1"))
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("sha1:%x", hash)
+}
+
+var (
+	apkPackageCache map[string]*packageInfo
+	apkPackageMutex sync.Mutex
+)
+
+// apkPackageInfos returns a map of all apk packages and their latest info. It is safe to call concurrently; the
+// indexes are only downloaded once.
 func apkPackageInfos() (map[string]*packageInfo, error) {
+	apkPackageMutex.Lock()
+	defer apkPackageMutex.Unlock()
+
 	if apkPackageCache != nil {
 		return apkPackageCache, nil
 	}
 
-	apkPackageCache = make(map[string]*packageInfo)
+	cache := make(map[string]*packageInfo)
 	for _, repo := range []string{"community", "main"} {
 		err := func() error {
 			u, err := url.JoinPath(*alpineMirror, fmt.Sprintf(apkIndexPath, repo))
@@ -77,7 +156,8 @@ func apkPackageInfos() (map[string]*packageInfo, error) {
 				return err
 			}
 			for k := range info {
-				apkPackageCache[k] = info[k]
+				info[k].Repository = u
+				cache[k] = info[k]
 			}
 			return nil
 		}()
@@ -86,6 +166,7 @@ func apkPackageInfos() (map[string]*packageInfo, error) {
 		}
 	}
 
+	apkPackageCache = cache
 	return apkPackageCache, nil
 }
 
@@ -150,6 +231,10 @@ func readApkIndexContent(reader io.Reader) (map[string]*packageInfo, error) {
 			}
 		} else if strings.HasPrefix(line, "V:") {
 			current.Version = strings.TrimPrefix(line, "V:")
+		} else if strings.HasPrefix(line, "L:") {
+			current.Licence = strings.TrimPrefix(line, "L:")
+		} else if strings.HasPrefix(line, "C:") {
+			current.Checksum = strings.TrimPrefix(line, "C:")
 		}
 	}
 
@@ -164,6 +249,9 @@ func readApkIndexContent(reader io.Reader) (map[string]*packageInfo, error) {
 type packageInfo struct {
 	Name         string
 	Version      string
+	Licence      string
+	Checksum     string
+	Repository   string
 	Dependencies []string
 	Provides     []string
 }
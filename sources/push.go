@@ -0,0 +1,114 @@
+package sources
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// PushLayout pushes the image or manifest list in the OCI image layout at the given path to ref, returning the
+// digest of what was pushed. Blobs that already exist in the registry (such as those uploaded by an earlier,
+// failed, attempt) aren't uploaded again.
+//
+// The layout must contain a single image or manifest list. Credentials are the same as those used by LatestDigest.
+func PushLayout(path, ref string) (string, error) {
+	tag, err := name.ParseReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %v", ref, err)
+	}
+
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read layout %s: %v", path, err)
+	}
+
+	index, err := p.ImageIndex()
+	if err != nil {
+		return "", fmt.Errorf("unable to read layout %s: %v", path, err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return "", fmt.Errorf("unable to read layout %s: %v", path, err)
+	}
+
+	if len(manifest.Manifests) != 1 {
+		return "", fmt.Errorf("layout %s contains %d manifests, expected 1", path, len(manifest.Manifests))
+	}
+
+	var digest v1.Hash
+	desc := manifest.Manifests[0]
+	switch {
+	case desc.MediaType.IsIndex():
+		child, err := index.ImageIndex(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		if err := remote.WriteIndex(tag, child, remoteAuthOption()); err != nil {
+			return "", err
+		}
+		digest, err = child.Digest()
+		if err != nil {
+			return "", err
+		}
+	case desc.MediaType.IsImage():
+		image, err := index.Image(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		if err := remote.Write(tag, image, remoteAuthOption()); err != nil {
+			return "", err
+		}
+		digest, err = image.Digest()
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("layout %s contains unsupported media type %s", path, desc.MediaType)
+	}
+
+	return digest.String(), nil
+}
+
+// CopyImage copies the image or manifest list with the given digest from src to dst, so that both hold an identical
+// manifest, and then adds the given tags to it. The source is read using the same credentials as LatestDigest, and
+// creds are used for the destination.
+func CopyImage(src, digest, dst string, creds Credentials, tags ...string) error {
+	srcRef, err := name.NewDigest(fmt.Sprintf("%s@%s", src, digest))
+	if err != nil {
+		return fmt.Errorf("invalid image reference %s@%s: %v", src, digest, err)
+	}
+
+	dstRef, err := name.NewTag(dst)
+	if err != nil {
+		return fmt.Errorf("invalid image reference %s: %v", dst, err)
+	}
+
+	desc, err := remote.Get(srcRef, remoteAuthOption())
+	if err != nil {
+		return err
+	}
+
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		if err := remote.WriteIndex(dstRef, index, creds.remoteOption()); err != nil {
+			return err
+		}
+	} else {
+		image, err := desc.Image()
+		if err != nil {
+			return err
+		}
+		if err := remote.Write(dstRef, image, creds.remoteOption()); err != nil {
+			return err
+		}
+	}
+
+	return applyTags(dstRef.Context(), desc, creds.remoteOption(), tags...)
+}
@@ -0,0 +1,111 @@
+package sources
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRegistry(t *testing.T) string {
+	server := httptest.NewServer(ggcrregistry.New())
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestPushLayout_image(t *testing.T) {
+	reg := testRegistry(t)
+	image, err := random.Image(1024, 2)
+	require.NoError(t, err)
+
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendImage(image))
+
+	digest, err := PushLayout(string(p), reg+"/tools/web")
+	require.NoError(t, err)
+
+	expected, err := image.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), digest)
+
+	pushed, err := crane.Digest(reg + "/tools/web:latest")
+	require.NoError(t, err)
+	assert.Equal(t, digest, pushed)
+}
+
+func TestPushLayout_index(t *testing.T) {
+	reg := testRegistry(t)
+	index, err := random.Index(1024, 1, 2)
+	require.NoError(t, err)
+
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendIndex(index))
+
+	digest, err := PushLayout(string(p), reg+"/tools/web")
+	require.NoError(t, err)
+
+	expected, err := index.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), digest)
+
+	pushed, err := crane.Digest(reg + "/tools/web:latest")
+	require.NoError(t, err)
+	assert.Equal(t, digest, pushed)
+}
+
+func TestPushLayout_errors(t *testing.T) {
+	reg := testRegistry(t)
+
+	_, err := PushLayout(t.TempDir(), reg+"/tools/web")
+	assert.ErrorContains(t, err, "unable to read layout")
+
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		image, err := random.Image(1024, 1)
+		require.NoError(t, err)
+		require.NoError(t, p.AppendImage(image))
+	}
+
+	_, err = PushLayout(string(p), reg+"/tools/web")
+	assert.ErrorContains(t, err, "contains 2 manifests")
+
+	_, err = PushLayout(string(p), "Not A Valid Ref")
+	assert.ErrorContains(t, err, "invalid image reference")
+}
+
+func TestCopyImage(t *testing.T) {
+	src, dst := testRegistry(t), testRegistry(t)
+	index, err := random.Index(1024, 1, 2)
+	require.NoError(t, err)
+
+	p, err := layout.Write(t.TempDir(), empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, p.AppendIndex(index))
+
+	digest, err := PushLayout(string(p), src+"/tools/web")
+	require.NoError(t, err)
+
+	require.NoError(t, CopyImage(src+"/tools/web", digest, dst+"/mirror/tools-web", Credentials{}, "1.2", "20261019"))
+
+	for _, tag := range []string{"latest", "1.2", "20261019"} {
+		copied, err := crane.Digest(dst + "/mirror/tools-web:" + tag)
+		require.NoError(t, err, tag)
+		assert.Equal(t, digest, copied, tag)
+	}
+}
+
+func TestCopyImage_missingSource(t *testing.T) {
+	src, dst := testRegistry(t), testRegistry(t)
+	err := CopyImage(src+"/tools/web", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", dst+"/tools/web", Credentials{})
+	assert.Error(t, err)
+}
@@ -2,151 +2,421 @@ package contempt
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/csmith/contempt/sources"
 )
 
-var templateFuncs template.FuncMap
-
-func init() {
-	templateFuncs = template.FuncMap{
-		"image":               image,
-		"alpine_packages":     alpinePackages,
-		"github_tag":          gitHubTag,
-		"prefixed_github_tag": prefixedGitHubTag,
-		"git_tag":             gitTag,
-		"prefixed_git_tag":    prefixedGitTag,
-		"registry":            sources.Registry,
-		"regex_url_content":   regexURLContent,
+// templateFuncs returns the functions available to templates. Any materials resolved by the functions are recorded in
+// the given map, so each render must use its own.
+func templateFuncs(materials map[string]Material) template.FuncMap {
+	funcs := template.FuncMap{
+		"image": func(ref string) (string, error) {
+			return image(materials, ref)
+		},
+		"alpine_packages": func(packages ...string) (map[string]string, error) {
+			return alpinePackages(materials, packages...)
+		},
+		"github_tag": func(repo string) (string, error) {
+			return gitHubTag(materials, repo, "")
+		},
+		"prefixed_github_tag": func(repo, prefix string) (string, error) {
+			return gitHubTag(materials, repo, prefix)
+		},
+		"git_tag": func(repo string) (string, error) {
+			return gitTag(materials, repo, "")
+		},
+		"prefixed_git_tag": func(repo, prefix string) (string, error) {
+			return gitTag(materials, repo, prefix)
+		},
+		"registry": sources.Registry,
+		"regex_url_content": func(name, url, regex string) (string, error) {
+			return regexURLContent(materials, name, url, regex)
+		},
 		"increment_int": func(x int) int {
 			return x + 1
 		},
 	}
-	addRelease("alpine", sources.LatestAlpineRelease)
-	addRelease("golang", sources.LatestGolangRelease)
-	addRelease("postgres13", sources.LatestPostgresRelease("13"))
-	addRelease("postgres14", sources.LatestPostgresRelease("14"))
-	addRelease("postgres15", sources.LatestPostgresRelease("15"))
+
+	for i := range releases {
+		r := releases[i]
+		funcs[fmt.Sprintf("%s_url", r.name)] = func() string {
+			return releaseURL(materials, r)
+		}
+		funcs[fmt.Sprintf("%s_checksum", r.name)] = func() string {
+			return releaseChecksum(r)
+		}
+	}
+
+	funcs["postgres_url"] = func(major interface{}) string {
+		return releaseURL(materials, postgres(major))
+	}
+	funcs["postgres_checksum"] = func(major interface{}) string {
+		return releaseChecksum(postgres(major))
+	}
+
+	return funcs
+}
+
+// release is a piece of software whose latest release is made available to templates. The latest release is only
+// looked up once, and shared by all projects.
+type release struct {
+	name     string
+	provider func() (version, url, checksum string)
+	once     sync.Once
+	version  string
+	url      string
+	checksum string
+}
+
+func (r *release) check() {
+	r.once.Do(func() {
+		r.version, r.url, r.checksum = r.provider()
+	})
+}
+
+var releases = []*release{
+	{name: "alpine", provider: sources.LatestAlpineRelease},
+	{name: "golang", provider: sources.LatestGolangRelease},
+	postgres("13"),
+	postgres("14"),
+	postgres("15"),
 }
 
-func image(ref string) string {
+// releaseURL returns the URL of the release, recording it as a material.
+func releaseURL(materials map[string]Material, r *release) string {
+	r.check()
+	materials[r.name] = Material{
+		Type:    "release",
+		Source:  r.url,
+		Version: r.version,
+		Digest:  fmt.Sprintf("sha256:%s", r.checksum),
+	}
+	return r.url
+}
+
+// releaseChecksum returns the checksum of the release.
+func releaseChecksum(r *release) string {
+	r.check()
+	return r.checksum
+}
+
+// postgresRelease provides the latest release of the given major version of Postgres.
+var postgresRelease = sources.LatestPostgresRelease
+
+var (
+	postgresMutex    sync.Mutex
+	postgresReleases = make(map[string]*release)
+)
+
+// postgres returns the release for the given major version of Postgres (e.g. 16 or "16"). Each major version is only
+// looked up once, regardless of whether it's accessed via postgres_url or one of the fixed postgresNN_url functions.
+func postgres(major interface{}) *release {
+	postgresMutex.Lock()
+	defer postgresMutex.Unlock()
+
+	name := fmt.Sprintf("postgres%v", major)
+	if r, ok := postgresReleases[name]; ok {
+		return r
+	}
+
+	r := &release{name: name, provider: postgresRelease(fmt.Sprint(major))}
+	postgresReleases[name] = r
+	return r
+}
+
+func image(materials map[string]Material, ref string) (string, error) {
 	im, digest, err := sources.LatestDigest(ref)
 	if err != nil {
-		log.Fatalf("Unable to get latest digest for ref %s: %v", ref, err)
+		return "", fmt.Errorf("unable to get latest digest for ref %s: %v", ref, err)
+	}
+	m := Material{
+		Type:    "image",
+		Source:  im,
+		Version: strings.TrimPrefix(digest, "sha256:"),
+		Digest:  digest,
+	}
+	if _, internal := projectDependency(ref); internal {
+		// Record the digests of each platform for images built by this repo, as they may be multi-platform.
+		m.Platforms, err = sources.PlatformDigests(fmt.Sprintf("%s@%s", im, digest))
+		if err != nil {
+			return "", fmt.Errorf("unable to get platform digests for ref %s: %v", ref, err)
+		}
+		if len(m.Platforms) == 0 {
+			m.Platforms = nil
+		}
 	}
-	materials[fmt.Sprintf("image:%s", ref)] = strings.TrimPrefix(digest, "sha256:")
-	return fmt.Sprintf("%s@%s", im, digest)
+	materials[fmt.Sprintf("image:%s", ref)] = m
+	return fmt.Sprintf("%s@%s", im, digest), nil
 }
 
-func alpinePackages(packages ...string) map[string]string {
-	res, err := sources.LatestAlpinePackages(packages...)
+func alpinePackages(materials map[string]Material, packages ...string) (map[string]string, error) {
+	res, parents, err := sources.ResolveAlpinePackages(packages...)
 	if err != nil {
-		log.Fatalf("Unable to get latest packages: %v", err)
+		return nil, fmt.Errorf("unable to get latest packages: %v", err)
 	}
 	for i := range res {
-		materials[fmt.Sprintf("apk:%s", i)] = res[i]
+		m := Material{Type: "apk", Version: res[i]}
+		for parent := parents[i]; parent != ""; parent = parents[parent] {
+			m.RequiredBy = append([]string{fmt.Sprintf("apk:%s", parent)}, m.RequiredBy...)
+		}
+		if details, err := sources.LatestAlpinePackage(i); err == nil && details.Version == res[i] {
+			m.Source = details.Repository
+			m.Digest = details.Checksum
+			m.Licence = details.Licence
+		}
+		materials[fmt.Sprintf("apk:%s", i)] = m
 	}
-	return res
+	return res, nil
 }
 
-func gitHubTag(repo string) string {
-	tag, err := sources.LatestGitHubTag(repo, "")
-	if err != nil {
-		log.Fatalf("Couldn't determine latest tag for repo %s: %v", repo, err)
+func gitHubTag(materials map[string]Material, repo, prefix string) (string, error) {
+	tag, commit, err := sources.LatestGitHubTag(repo, prefix)
+	if err != nil && prefix != "" {
+		return "", fmt.Errorf("couldn't determine latest tag for repo %s with prefix '%s': %v", repo, prefix, err)
+	} else if err != nil {
+		return "", fmt.Errorf("couldn't determine latest tag for repo %s: %v", repo, err)
 	}
-	materials[fmt.Sprintf("github:%s", repo)] = tag
-	return tag
+	materials[fmt.Sprintf("github:%s", repo)] = gitMaterial("github", fmt.Sprintf("https://github.com/%s", repo), tag, prefix, commit)
+	return tag, nil
 }
 
-func prefixedGitHubTag(repo, prefix string) string {
-	tag, err := sources.LatestGitHubTag(repo, prefix)
-	if err != nil {
-		log.Fatalf("Couldn't determine latest tag for repo %s with prefix '%s': %v", repo, prefix, err)
+func gitTag(materials map[string]Material, repo, prefix string) (string, error) {
+	tag, commit, err := sources.LatestGitTag(repo, prefix)
+	if err != nil && prefix != "" {
+		return "", fmt.Errorf("couldn't determine latest tag for repo %s with prefix '%s': %v", repo, prefix, err)
+	} else if err != nil {
+		return "", fmt.Errorf("couldn't determine latest tag for repo %s: %v", repo, err)
 	}
-	materials[fmt.Sprintf("github:%s", repo)] = strings.TrimPrefix(tag, prefix)
-	return tag
+	materials[fmt.Sprintf("git:%s", repo)] = gitMaterial("git", repo, tag, prefix, commit)
+	return tag, nil
 }
 
-func gitTag(repo string) string {
-	tag, err := sources.LatestGitTag(repo, "")
+func regexURLContent(materials map[string]Material, name, url, regex string) (string, error) {
+	res, err := sources.RegexURLContent(url, regex)
 	if err != nil {
-		log.Fatalf("Couldn't determine latest tag for repo %s: %v", repo, err)
+		return "", fmt.Errorf("couldn't find regex in url '%s': %v", name, err)
+	}
+	materials[fmt.Sprintf("regexurl:%s", name)] = Material{
+		Type:    "regexurl",
+		Source:  url,
+		Version: res,
 	}
-	materials[fmt.Sprintf("git:%s", repo)] = tag
-	return tag
+	return res, nil
 }
 
-func prefixedGitTag(repo, prefix string) string {
-	tag, err := sources.LatestGitTag(repo, prefix)
-	if err != nil {
-		log.Fatalf("Couldn't determine latest tag for repo %s with prefix '%s': %v", repo, prefix, err)
+func gitMaterial(kind, repo, tag, prefix, commit string) Material {
+	m := Material{
+		Type:    kind,
+		Source:  repo,
+		Version: strings.TrimPrefix(tag, prefix),
+		Tag:     tag,
 	}
-	materials[fmt.Sprintf("git:%s", repo)] = strings.TrimPrefix(tag, prefix)
-	return tag
+	if commit != "" {
+		m.Digest = fmt.Sprintf("sha1:%s", commit)
+	}
+	return m
 }
 
-func regexURLContent(name, url, regex string) string {
-	res, err := sources.RegexURLContent(url, regex)
-	if err != nil {
-		log.Fatalf("Couldn't find regex in url '%s'", name)
+// parseTemplate parses the templates at the given paths, along with any shared partials (files matching *.gotpl)
+// found in partialsDir. Partials are parsed first so that a project can override any definitions they provide.
+func parseTemplate(paths []string, partialsDir string, funcs template.FuncMap) (*template.Template, error) {
+	tpl := template.New(paths[0])
+	tpl.Funcs(funcs)
+
+	if partialsDir != "" {
+		partials, err := filepath.Glob(filepath.Join(partialsDir, "*.gotpl"))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(partials) > 0 {
+			if _, err := tpl.ParseFiles(partials...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := tpl.ParseFiles(paths...); err != nil {
+		return nil, err
 	}
-	materials[fmt.Sprintf("regexurl:%s", name)] = res
-	return res
+
+	return tpl, nil
 }
 
-func addRelease(name string, provider func() (version, url, checksum string)) {
-	var version, url, checksum string
-	once := sync.Once{}
-	check := func() {
-		once.Do(func() {
-			version, url, checksum = provider()
-		})
+// File is a single file rendered from a template.
+type File struct {
+	// Name is the name of the file within the project's output directory.
+	Name string
+	// Content is the rendered content of the file.
+	Content []byte
+	// Mode is the permissions the file should be written with.
+	Mode os.FileMode
+	// Existed indicates whether the file already existed in the output directory.
+	Existed bool
+	// Previous is the content of the existing file in the output directory, if there was one.
+	Previous []byte
+}
+
+// Changed determines whether the rendered content differs from the existing file.
+func (f File) Changed() bool {
+	return !f.Existed || !bytes.Equal(f.Content, f.Previous)
+}
+
+// Result describes the outcome of rendering a project.
+type Result struct {
+	// Dir is the project's output directory.
+	Dir string
+	// Files contains all the rendered files, starting with the main output file.
+	Files []File
+	// Changes contains the differences between the previous and current bill of materials.
+	Changes []Change
+	// Violations contains any materials that aren't permitted by the policy in the input directory.
+	Violations []Violation
+	// Materials contains all the materials resolved while rendering, keyed by name.
+	Materials map[string]Material
+}
+
+// Changed determines whether any of the rendered files differ from the existing files in the output directory.
+func (r *Result) Changed() bool {
+	for i := range r.Files {
+		if r.Files[i].Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// FileNames returns the names of all the files in the result.
+func (r *Result) FileNames() []string {
+	names := make([]string, len(r.Files))
+	for i := range r.Files {
+		names[i] = r.Files[i].Name
+	}
+	return names
+}
+
+// Write writes all the rendered files to the output directory.
+func (r *Result) Write() error {
+	if err := os.MkdirAll(r.Dir, os.FileMode(0755)); err != nil {
+		return fmt.Errorf("unable to create output directory %s: %v", r.Dir, err)
+	}
+
+	for i := range r.Files {
+		path := filepath.Join(r.Dir, r.Files[i].Name)
+		if err := os.WriteFile(path, r.Files[i].Content, r.Files[i].Mode); err != nil {
+			return fmt.Errorf("unable to write file to %s: %v", path, err)
+		}
 	}
 
-	templateFuncs[fmt.Sprintf("%s_url", name)] = func() string {
-		check()
-		materials[name] = version
-		return url
+	return nil
+}
+
+// Generate renders the project's templates and writes them into outDir. See Render for details. If any materials
+// violate the policy, nothing is written and an error is returned.
+func Generate(sourceLink, inBase string, project Project, outDir, outputName, partialsDir string) (*Result, error) {
+	res, err := Render(sourceLink, inBase, project, outDir, outputName, partialsDir)
+	if err != nil {
+		return nil, err
 	}
 
-	templateFuncs[fmt.Sprintf("%s_checksum", name)] = func() string {
-		check()
-		return checksum
+	if len(res.Violations) > 0 {
+		var violations []string
+		for i := range res.Violations {
+			violations = append(violations, res.Violations[i].Error())
+		}
+		return res, fmt.Errorf("policy violations: %s", strings.Join(violations, "; "))
 	}
+
+	return res, res.Write()
 }
 
-func Generate(sourceLink, inBase, inRelativePath, outFile string) ([]Change, error) {
-	materials = make(map[string]string)
+// Render renders the project's templates in memory, without writing them. The main template is rendered to
+// outputName, with a header containing the bill of materials; any extra templates are rendered without their ".gotpl"
+// suffix. Changes are determined by comparing against the BOM in the existing output file in outDir, and the
+// resolved materials are checked against the policy file in inBase (if any).
+func Render(sourceLink, inBase string, project Project, outDir, outputName, partialsDir string) (*Result, error) {
+	policy, err := readPolicy(inBase)
+	if err != nil {
+		return nil, err
+	}
+
+	materials := make(map[string]Material)
+	outFile := filepath.Join(outDir, outputName)
 	oldMaterials := readBillOfMaterials(outFile)
-	inFile := filepath.Join(inBase, inRelativePath)
 
-	tpl := template.New(inFile)
-	tpl.Funcs(templateFuncs)
+	inFiles := []string{filepath.Join(inBase, project.Template)}
+	for i := range project.Extras {
+		inFiles = append(inFiles, filepath.Join(inBase, project.Extras[i]))
+	}
+
+	tpl, err := parseTemplate(inFiles, partialsDir, templateFuncs(materials))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template file %s: %v", inFiles[0], err)
+	}
+
+	res := &Result{Dir: outDir, Materials: materials}
+
+	// Render the extra templates first so that any materials they use are included in the main file's BOM.
+	for i := 1; i < len(inFiles); i++ {
+		writer := &bytes.Buffer{}
+		if err := tpl.ExecuteTemplate(writer, filepath.Base(inFiles[i]), project.Values); err != nil {
+			return nil, fmt.Errorf("unable to render template file %s: %v", inFiles[i], err)
+		}
+
+		mode := os.FileMode(0600)
+		if info, err := os.Stat(inFiles[i]); err == nil {
+			mode = info.Mode().Perm()
+		}
 
-	if _, err := tpl.ParseFiles(inFile); err != nil {
-		return nil, fmt.Errorf("unable to parse template file %s: %v", inFile, err)
+		res.Files = append(res.Files, File{
+			Name:    strings.TrimSuffix(filepath.Base(inFiles[i]), ".gotpl"),
+			Content: writer.Bytes(),
+			Mode:    mode,
+		})
 	}
 
 	writer := &bytes.Buffer{}
-	if err := tpl.ExecuteTemplate(writer, filepath.Base(inFile), nil); err != nil {
+	if err := tpl.ExecuteTemplate(writer, filepath.Base(inFiles[0]), project.Values); err != nil {
 		return nil, fmt.Errorf("unable to render template file %s: %v", outFile, err)
 	}
 
-	bom, _ := json.Marshal(materials)
-	header := fmt.Sprintf("# Generated from %s%s\n# BOM: %s\n\n", sourceLink, inRelativePath, bom)
+	carryResolutionTimes(oldMaterials, materials, time.Now().UTC().Truncate(time.Second))
+	res.Changes = diffMaterials(oldMaterials, materials)
+
+	bom := formatBillOfMaterials(materials)
+	if len(res.Changes) == 0 && isLegacyBillOfMaterials(oldMaterials) {
+		// Upgrading every project's BOM at once would make them all appear to have changed, so keep the original
+		// format until one of the project's materials actually changes.
+		bom = formatLegacyBillOfMaterials(materials)
+	}
+
+	header := fmt.Sprintf(
+		"# Generated from %s%s\n# BOM: %s\n\n",
+		sourceLink,
+		filepath.ToSlash(project.Template),
+		bom,
+	)
+
+	res.Files = append([]File{{
+		Name:    outputName,
+		Content: append([]byte(header), writer.Bytes()...),
+		Mode:    os.FileMode(0600),
+	}}, res.Files...)
 
-	content := append([]byte(header), writer.Bytes()...)
-	if err := os.WriteFile(outFile, content, os.FileMode(0600)); err != nil {
-		return nil, fmt.Errorf("unable to write container file to %s: %v", outFile, err)
+	for i := range res.Files {
+		if previous, err := os.ReadFile(filepath.Join(outDir, res.Files[i].Name)); err == nil {
+			res.Files[i].Existed = true
+			res.Files[i].Previous = previous
+		}
 	}
 
-	return diffMaterials(oldMaterials, materials), nil
+	res.Violations = policy.Check(project.Name, materials)
+	return res, nil
 }
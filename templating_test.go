@@ -0,0 +1,252 @@
+package contempt
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTemplate_partials(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "partial used by project",
+			files: map[string]string{
+				"_templates/base.gotpl": `{{define "base"}}partial{{end}}`,
+				"app/Dockerfile.gotpl":  `{{template "base"}}`,
+			},
+			want: "partial",
+		},
+		{
+			name: "project overrides partial",
+			files: map[string]string{
+				"_templates/base.gotpl": `{{define "base"}}partial{{end}}`,
+				"app/Dockerfile.gotpl":  `{{define "base"}}project{{end}}{{template "base"}}`,
+			},
+			want: "project",
+		},
+		{
+			name: "later partial overrides earlier partial",
+			files: map[string]string{
+				"_templates/a.gotpl":   `{{define "base"}}a{{end}}`,
+				"_templates/b.gotpl":   `{{define "base"}}b{{end}}`,
+				"app/Dockerfile.gotpl": `{{template "base"}}`,
+			},
+			want: "b",
+		},
+		{
+			name: "project overrides partial with the same file name",
+			files: map[string]string{
+				"_templates/Dockerfile.gotpl": `partial`,
+				"app/Dockerfile.gotpl":        `project`,
+			},
+			want: "project",
+		},
+		{
+			name: "partial uses definition from project",
+			files: map[string]string{
+				"_templates/base.gotpl": `{{define "base"}}FROM {{template "image"}}{{end}}{{define "image"}}partial{{end}}`,
+				"app/Dockerfile.gotpl":  `{{define "image"}}project{{end}}{{template "base"}}`,
+			},
+			want: "FROM project",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeProjectFiles(t, tt.files)
+
+			tpl, err := parseTemplate(
+				[]string{filepath.Join(dir, "app", "Dockerfile.gotpl")},
+				filepath.Join(dir, "_templates"),
+				template.FuncMap{},
+			)
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, tpl.ExecuteTemplate(buf, "Dockerfile.gotpl", nil))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestFindProjects_partialDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		partials string
+		template string
+		want     []string
+	}{
+		{
+			name:     "image in partial",
+			partials: `{{define "base"}}FROM {{image "shared"}}{{end}}`,
+			template: `{{template "base"}}`,
+			want:     []string{"shared"},
+		},
+		{
+			name:     "unused partial",
+			partials: `{{define "base"}}FROM {{image "shared"}}{{end}}`,
+			template: `FROM {{image "other"}}`,
+			want:     []string{"other"},
+		},
+		{
+			name:     "partial overridden by project",
+			partials: `{{define "base"}}FROM {{image "shared"}}{{end}}`,
+			template: `{{define "base"}}FROM {{image "other"}}{{end}}{{template "base"}}`,
+			want:     []string{"other"},
+		},
+		{
+			name:     "partial using definition overridden by project",
+			partials: `{{define "base"}}FROM {{template "image"}}{{end}}{{define "image"}}{{image "shared"}}{{end}}`,
+			template: `{{define "image"}}{{image "other"}}{{end}}{{template "base"}}`,
+			want:     []string{"other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeProjectFiles(t, map[string]string{
+				"_templates/base.gotpl":   tt.partials,
+				"app/Dockerfile.gotpl":    tt.template,
+				"other/Dockerfile.gotpl":  `FROM scratch`,
+				"shared/Dockerfile.gotpl": `FROM scratch`,
+			})
+
+			projects, err := FindProjects(dir, "Dockerfile.gotpl", filepath.Join(dir, "_templates"))
+			require.NoError(t, err)
+
+			for i := range projects {
+				if projects[i].Name == "app" {
+					assert.Equal(t, tt.want, projects[i].Dependencies)
+					return
+				}
+			}
+			t.Fatal("app project not found")
+		})
+	}
+}
+
+func TestRender_legacyBillOfMaterials(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"app/Dockerfile.gotpl": `FROM scratch
+ENV VERSION={{regex_url_content "app" .url "version=([0-9.]+)"}}`,
+		"out/app/Dockerfile": `# Generated from https://example.com/app/Dockerfile.gotpl
+# BOM: {"regexurl:app":"1.2.3"}
+
+FROM scratch
+ENV VERSION=1.2.3`,
+	})
+	outDir := filepath.Join(dir, "out", "app")
+
+	render := func(version string) *Result {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "version=%s", version)
+		}))
+		defer server.Close()
+
+		project := Project{
+			Name:     "app",
+			Template: filepath.Join("app", "Dockerfile.gotpl"),
+			Values:   map[string]interface{}{"url": server.URL},
+		}
+		result, err := Render("https://example.com/", dir, project, outDir, "Dockerfile", "")
+		require.NoError(t, err)
+		return result
+	}
+
+	result := render("1.2.3")
+	assert.False(t, result.Changed())
+	assert.Empty(t, result.Changes)
+
+	result = render("1.2.4")
+	assert.True(t, result.Changed())
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, Changed, result.Changes[0].Kind)
+
+	require.NoError(t, result.Write())
+	content, err := os.ReadFile(filepath.Join(outDir, "Dockerfile"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `# BOM: {"schema":2,"materials":{"regexurl:app":{"type":"regexurl"`)
+}
+
+func TestRender_extraTemplates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "version=1.2.3")
+	}))
+	defer server.Close()
+
+	dir := writeProjectFiles(t, map[string]string{
+		"app/Dockerfile.gotpl": `FROM scratch
+COPY entrypoint.sh /`,
+		"app/entrypoint.sh.gotpl": `#!/bin/sh
+echo {{regex_url_content "app" .url "version=([0-9.]+)"}}`,
+	})
+	require.NoError(t, os.Chmod(filepath.Join(dir, "app", "entrypoint.sh.gotpl"), 0750))
+
+	projects, err := FindProjects(dir, "Dockerfile.gotpl", "")
+	require.NoError(t, err)
+	require.Len(t, projects, 1)
+
+	project := projects[0]
+	project.Values = map[string]interface{}{"url": server.URL}
+	outDir := filepath.Join(dir, "out", "app")
+
+	result, err := Render("https://example.com/", dir, project, outDir, "Dockerfile", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Dockerfile", "entrypoint.sh"}, result.FileNames())
+	assert.Contains(t, result.Materials, "regexurl:app", "materials used only in extra templates should be in the BOM")
+	assert.Contains(t, string(result.Files[0].Content), `"regexurl:app":{"type":"regexurl"`)
+
+	require.NoError(t, result.Write())
+
+	content, err := os.ReadFile(filepath.Join(outDir, "entrypoint.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho 1.2.3", string(content))
+
+	info, err := os.Stat(filepath.Join(outDir, "entrypoint.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+}
+
+func TestRender_postgresVariants(t *testing.T) {
+	oldRelease := postgresRelease
+	defer func() { postgresRelease = oldRelease }()
+	postgresRelease = func(major string) func() (string, string, string) {
+		return func() (string, string, string) {
+			return major + ".1", "https://example.com/postgresql-" + major + ".1.tar.bz2", "abc" + major
+		}
+	}
+
+	dir := writeProjectFiles(t, map[string]string{
+		"postgres/Dockerfile.gotpl": `ADD {{postgres_url .major}} /
+RUN echo "{{postgres_checksum .major}}"`,
+		"postgres/values.yaml": "variants:\n  matrix:\n    major: [98, 99]\n  name: \"postgres{{.major}}\"\n",
+	})
+
+	projects, err := FindProjects(dir, "Dockerfile.gotpl", "")
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+
+	for i := range projects {
+		major := strings.TrimPrefix(projects[i].Name, "postgres")
+		result, err := Render("https://example.com/", dir, projects[i], filepath.Join(dir, "out", projects[i].Name), "Dockerfile", "")
+		require.NoError(t, err)
+
+		assert.Contains(t, string(result.Files[0].Content), fmt.Sprintf("ADD https://example.com/postgresql-%s.1.tar.bz2 /\nRUN echo \"abc%s\"", major, major))
+		material := result.Materials[projects[i].Name]
+		assert.Equal(t, "release", material.Type)
+		assert.Equal(t, major+".1", material.Version)
+		assert.Equal(t, "sha256:abc"+major, material.Digest)
+	}
+}
@@ -0,0 +1,100 @@
+package contempt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// valuesName is the name of the file that provides data to templates. A values file in the root of the input
+// directory provides defaults for all projects, which can then be overridden by a file in each project.
+const valuesName = "values.yaml"
+
+// projectValues returns the data that should be passed to the template for the project in the given directory.
+// Variants are only read from the project's own values, as inheriting them would expand every project.
+func projectValues(inBase, projectDir string) (map[string]interface{}, error) {
+	defaults, err := readValues(filepath.Join(inBase, valuesName))
+	if err != nil {
+		return nil, err
+	}
+	delete(defaults, variantsKey)
+
+	values, err := readValues(filepath.Join(projectDir, valuesName))
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeValues(defaults, values), nil
+}
+
+// readValues reads a YAML values file. If the file does not exist, an empty map is returned.
+func readValues(path string) (map[string]interface{}, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]interface{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(bs, &values); err != nil {
+		return nil, fmt.Errorf("invalid values file %s: %v", path, err)
+	}
+
+	res, _ := normaliseValue(values).(map[string]interface{})
+	if res == nil {
+		res = map[string]interface{}{}
+	}
+	return res, nil
+}
+
+// normaliseValue converts the map[interface{}]interface{} values produced by the YAML decoder into
+// map[string]interface{}, so they behave consistently when used in templates.
+func normaliseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k := range v {
+			res[fmt.Sprintf("%v", k)] = normaliseValue(v[k])
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k := range v {
+			res[k] = normaliseValue(v[k])
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = normaliseValue(v[i])
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// mergeValues returns a copy of base with all the values in override applied on top. Nested maps are merged
+// recursively; all other values (including lists) in override replace those in base.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(base)+len(override))
+	for k := range base {
+		res[k] = base[k]
+	}
+
+	for k := range override {
+		baseMap, baseIsMap := res[k].(map[string]interface{})
+		overrideMap, overrideIsMap := override[k].(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			res[k] = mergeValues(baseMap, overrideMap)
+		} else {
+			res[k] = override[k]
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,73 @@
+package contempt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mergeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     map[string]interface{}
+		override map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{
+			"Returns base if there are no overrides",
+			map[string]interface{}{"port": 80},
+			map[string]interface{}{},
+			map[string]interface{}{"port": 80},
+		},
+		{
+			"Overrides top-level values",
+			map[string]interface{}{"port": 80, "user": "root"},
+			map[string]interface{}{"port": 8080},
+			map[string]interface{}{"port": 8080, "user": "root"},
+		},
+		{
+			"Merges nested maps",
+			map[string]interface{}{"features": map[string]interface{}{"a": true, "b": true}},
+			map[string]interface{}{"features": map[string]interface{}{"b": false}},
+			map[string]interface{}{"features": map[string]interface{}{"a": true, "b": false}},
+		},
+		{
+			"Replaces lists entirely",
+			map[string]interface{}{"ports": []interface{}{80, 443}},
+			map[string]interface{}{"ports": []interface{}{8080}},
+			map[string]interface{}{"ports": []interface{}{8080}},
+		},
+		{
+			"Replaces maps with scalars",
+			map[string]interface{}{"user": map[string]interface{}{"name": "nonroot"}},
+			map[string]interface{}{"user": "root"},
+			map[string]interface{}{"user": "root"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergeValues(tt.base, tt.override))
+		})
+	}
+}
+
+func Test_projectValues_variantsNotInherited(t *testing.T) {
+	dir := writeProjectFiles(t, map[string]string{
+		"values.yaml":    "user: root\nvariants:\n  matrix:\n    version: [1, 2]\n",
+		"db/values.yaml": "variants:\n  matrix:\n    major: [15, 16]\n",
+	})
+
+	values, err := projectValues(dir, filepath.Join(dir, "web"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"user": "root"}, values)
+
+	values, err = projectValues(dir, filepath.Join(dir, "db"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"user":     "root",
+		"variants": map[string]interface{}{"matrix": map[string]interface{}{"major": []interface{}{15, 16}}},
+	}, values)
+}
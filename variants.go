@@ -0,0 +1,118 @@
+package contempt
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// variantsKey is the key in a project's values that declares variants of the project.
+const variantsKey = "variants"
+
+// variant is a single expanded variant of a project.
+type variant struct {
+	name   string
+	values map[string]interface{}
+}
+
+// expandVariants returns all the variants that should be generated for a project. Variants are declared in the
+// project's values as a matrix of keys to lists of values, along with an optional template for the variant's name:
+//
+//	variants:
+//	  matrix:
+//	    major: [13, 14, 15]
+//	  name: "postgres{{.major}}"
+//
+// Each combination of matrix values produces a variant whose values have the corresponding keys set. If no name
+// template is given, the variant is named after the project followed by each of its matrix values. Projects that
+// don't declare any variants produce a single variant named after the project itself.
+func expandVariants(project string, values map[string]interface{}) ([]variant, error) {
+	spec, ok := values[variantsKey]
+	if !ok {
+		return []variant{{name: project, values: values}}, nil
+	}
+
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", variantsKey)
+	}
+
+	matrix, ok := specMap["matrix"].(map[string]interface{})
+	if !ok || len(matrix) == 0 {
+		return nil, fmt.Errorf("%s.matrix must be a non-empty map", variantsKey)
+	}
+
+	var nameTemplate *template.Template
+	if name, ok := specMap["name"]; ok {
+		nameString, ok := name.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.name must be a string", variantsKey)
+		}
+
+		var err error
+		nameTemplate, err = template.New("name").Option("missingkey=error").Parse(nameString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s.name: %v", variantsKey, err)
+		}
+	}
+
+	var keys []string
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	base := make(map[string]interface{}, len(values))
+	for k := range values {
+		if k != variantsKey {
+			base[k] = values[k]
+		}
+	}
+
+	combinations := []map[string]interface{}{{}}
+	for _, k := range keys {
+		options, ok := matrix[k].([]interface{})
+		if !ok || len(options) == 0 {
+			return nil, fmt.Errorf("%s.matrix.%s must be a non-empty list", variantsKey, k)
+		}
+
+		var next []map[string]interface{}
+		for i := range combinations {
+			for j := range options {
+				combination := make(map[string]interface{}, len(combinations[i])+1)
+				for ck := range combinations[i] {
+					combination[ck] = combinations[i][ck]
+				}
+				combination[k] = options[j]
+				next = append(next, combination)
+			}
+		}
+		combinations = next
+	}
+
+	res := make([]variant, len(combinations))
+	for i := range combinations {
+		variantValues := mergeValues(base, combinations[i])
+
+		var name string
+		if nameTemplate == nil {
+			parts := []string{project}
+			for _, k := range keys {
+				parts = append(parts, fmt.Sprintf("%v", combinations[i][k]))
+			}
+			name = strings.Join(parts, "-")
+		} else {
+			buf := &bytes.Buffer{}
+			if err := nameTemplate.Execute(buf, variantValues); err != nil {
+				return nil, fmt.Errorf("unable to render %s.name: %v", variantsKey, err)
+			}
+			name = buf.String()
+		}
+
+		res[i] = variant{name: name, values: variantValues}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package contempt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expandVariants(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		want    []variant
+		wantErr bool
+	}{
+		{
+			"Returns the project itself if there are no variants",
+			map[string]interface{}{"port": 80},
+			[]variant{{name: "project", values: map[string]interface{}{"port": 80}}},
+			false,
+		},
+		{
+			"Expands a single key using the name template",
+			map[string]interface{}{
+				"port": 80,
+				"variants": map[string]interface{}{
+					"matrix": map[string]interface{}{"major": []interface{}{13, 14}},
+					"name":   "postgres{{.major}}",
+				},
+			},
+			[]variant{
+				{name: "postgres13", values: map[string]interface{}{"port": 80, "major": 13}},
+				{name: "postgres14", values: map[string]interface{}{"port": 80, "major": 14}},
+			},
+			false,
+		},
+		{
+			"Expands multiple keys using the default name",
+			map[string]interface{}{
+				"variants": map[string]interface{}{
+					"matrix": map[string]interface{}{
+						"major":   []interface{}{1, 2},
+						"flavour": []interface{}{"a", "b"},
+					},
+				},
+			},
+			[]variant{
+				{name: "project-a-1", values: map[string]interface{}{"flavour": "a", "major": 1}},
+				{name: "project-a-2", values: map[string]interface{}{"flavour": "a", "major": 2}},
+				{name: "project-b-1", values: map[string]interface{}{"flavour": "b", "major": 1}},
+				{name: "project-b-2", values: map[string]interface{}{"flavour": "b", "major": 2}},
+			},
+			false,
+		},
+		{
+			"Errors if the matrix is missing",
+			map[string]interface{}{"variants": map[string]interface{}{"name": "foo"}},
+			nil,
+			true,
+		},
+		{
+			"Errors if a matrix entry is not a list",
+			map[string]interface{}{"variants": map[string]interface{}{"matrix": map[string]interface{}{"major": 13}}},
+			nil,
+			true,
+		},
+		{
+			"Errors if the name template references missing values",
+			map[string]interface{}{
+				"variants": map[string]interface{}{
+					"matrix": map[string]interface{}{"major": []interface{}{13}},
+					"name":   "postgres{{.minor}}",
+				},
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVariants("project", tt.values)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package contempt
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/go-version"
+)
+
+// VersionBump describes how significant a change between two versions is.
+type VersionBump string
+
+const (
+	// MajorBump indicates that the first component of the version changed.
+	MajorBump VersionBump = "major"
+	// MinorBump indicates that the second component of the version changed.
+	MinorBump VersionBump = "minor"
+	// PatchBump indicates that only later components (or suffixes/revisions) of the version changed.
+	PatchBump VersionBump = "patch"
+)
+
+// compareVersions compares two versions of a material of the given type, returning -1, 0 or 1 if a is less than,
+// equal to, or greater than b, along with the most significant component that differs. If the material's type isn't
+// versioned in an orderable way (e.g. images, which are versioned by digest), or the versions can't be parsed, ok
+// will be false.
+func compareVersions(kind, a, b string) (cmp int, bump VersionBump, ok bool) {
+	switch kind {
+	case "apk":
+		return compareApkVersions(a, b)
+	case "github", "git", "release":
+		return compareSemanticVersions(a, b)
+	default:
+		return 0, "", false
+	}
+}
+
+// versionPrefixes are the prefixes that are commonly added to versions in tags, and ignored when comparing them.
+var versionPrefixes = []string{"v", "go"}
+
+// compareSemanticVersions compares two (roughly) semver versions. A "v" or "go" prefix is ignored.
+func compareSemanticVersions(a, b string) (int, VersionBump, bool) {
+	av, err := version.NewVersion(trimVersionPrefix(a))
+	if err != nil {
+		return 0, "", false
+	}
+
+	bv, err := version.NewVersion(trimVersionPrefix(b))
+	if err != nil {
+		return 0, "", false
+	}
+
+	cmp := av.Compare(bv)
+	if cmp == 0 {
+		return 0, "", true
+	}
+
+	return cmp, bumpFromSegments(av.Segments(), bv.Segments()), true
+}
+
+// trimVersionPrefix removes any of the known versionPrefixes from the start of a version, if it is immediately
+// followed by a digit.
+func trimVersionPrefix(v string) string {
+	for _, prefix := range versionPrefixes {
+		if trimmed := strings.TrimPrefix(v, prefix); len(trimmed) < len(v) && trimmed != "" && unicode.IsDigit(rune(trimmed[0])) {
+			return trimmed
+		}
+	}
+	return v
+}
+
+// apkVersion is a parsed version of an Alpine package, in the form "1.2.3a_rc1_p2-r3".
+type apkVersion struct {
+	numbers  []int
+	letter   byte
+	suffixes []apkSuffix
+	revision int
+}
+
+type apkSuffix struct {
+	order  int
+	number int
+}
+
+// apkSuffixOrder gives the relative ordering of suffixes. Suffixes that are ordered below zero sort before a version
+// with no suffix (e.g. 1.0_rc1 < 1.0), while those ordered above sort after it (e.g. 1.0_p1 > 1.0).
+var apkSuffixOrder = map[string]int{
+	"alpha": -4,
+	"beta":  -3,
+	"pre":   -2,
+	"rc":    -1,
+	"cvs":   1,
+	"svn":   2,
+	"git":   3,
+	"hg":    4,
+	"p":     5,
+}
+
+// parseApkVersion parses a version string using the format used by Alpine's apk tools.
+func parseApkVersion(v string) (*apkVersion, bool) {
+	res := &apkVersion{}
+
+	if i := strings.LastIndex(v, "-r"); i != -1 {
+		revision, err := strconv.Atoi(v[i+2:])
+		if err != nil {
+			return nil, false
+		}
+		res.revision = revision
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, "_")
+	numbers := strings.Split(parts[0], ".")
+	for i := range numbers {
+		n := numbers[i]
+		if i == len(numbers)-1 && len(n) > 1 && n[len(n)-1] >= 'a' && n[len(n)-1] <= 'z' {
+			res.letter = n[len(n)-1]
+			n = n[:len(n)-1]
+		}
+
+		number, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, false
+		}
+		res.numbers = append(res.numbers, number)
+	}
+
+	for _, suffix := range parts[1:] {
+		name := strings.TrimRightFunc(suffix, unicode.IsDigit)
+		order, ok := apkSuffixOrder[name]
+		if !ok {
+			return nil, false
+		}
+
+		number := 0
+		if len(name) < len(suffix) {
+			number, _ = strconv.Atoi(suffix[len(name):])
+		}
+		res.suffixes = append(res.suffixes, apkSuffix{order: order, number: number})
+	}
+
+	return res, true
+}
+
+// compareApkVersions compares two versions of an Alpine package.
+func compareApkVersions(a, b string) (int, VersionBump, bool) {
+	av, ok := parseApkVersion(a)
+	if !ok {
+		return 0, "", false
+	}
+
+	bv, ok := parseApkVersion(b)
+	if !ok {
+		return 0, "", false
+	}
+
+	cmp := func() int {
+		for i := 0; i < len(av.numbers) || i < len(bv.numbers); i++ {
+			if i >= len(av.numbers) {
+				return -1
+			} else if i >= len(bv.numbers) {
+				return 1
+			} else if c := compareInts(av.numbers[i], bv.numbers[i]); c != 0 {
+				return c
+			}
+		}
+
+		if c := compareInts(int(av.letter), int(bv.letter)); c != 0 {
+			return c
+		}
+
+		for i := 0; i < len(av.suffixes) || i < len(bv.suffixes); i++ {
+			var as, bs apkSuffix
+			if i < len(av.suffixes) {
+				as = av.suffixes[i]
+			}
+			if i < len(bv.suffixes) {
+				bs = bv.suffixes[i]
+			}
+			if c := compareInts(as.order, bs.order); c != 0 {
+				return c
+			} else if c := compareInts(as.number, bs.number); c != 0 {
+				return c
+			}
+		}
+
+		return compareInts(av.revision, bv.revision)
+	}()
+
+	if cmp == 0 {
+		return 0, "", true
+	}
+
+	return cmp, bumpFromSegments(av.numbers, bv.numbers), true
+}
+
+// bumpFromSegments determines the most significant difference between two sets of numeric version segments.
+func bumpFromSegments(a, b []int) VersionBump {
+	segment := func(s []int, i int) int {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+
+	if segment(a, 0) != segment(b, 0) {
+		return MajorBump
+	} else if segment(a, 1) != segment(b, 1) {
+		return MinorBump
+	}
+	return PatchBump
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package contempt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		kind     string
+		a        string
+		b        string
+		wantCmp  int
+		wantBump VersionBump
+		wantOk   bool
+	}{
+		{"github", "v1.2.3", "v1.2.3", 0, "", true},
+		{"github", "v1.2.3", "v1.2.4", -1, PatchBump, true},
+		{"github", "v1.2.3", "v1.3.0", -1, MinorBump, true},
+		{"github", "v1.2.3", "v2.0.0", -1, MajorBump, true},
+		{"github", "v2.0.0", "v1.9.9", 1, MajorBump, true},
+		{"release", "go1.21.9", "go1.22.0", -1, MinorBump, true},
+		{"image", "abcdef", "fedcba", 0, "", false},
+		{"image", "3f2a9b", "9ac0e1", 0, "", false},
+		{"image", "abc123def456", "0fe987aa11", 0, "", false},
+		{"image", "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d", "18ac3e7343f016890c510e93f935261169d9e3f565436429830faf0934f4f8e4", 0, "", false},
+		{"regexurl", "1.2.3", "1.2.4", 0, "", false},
+		{"github", "release-1.2.3", "release-1.2.4", 0, "", false},
+		{"github", "1.2.3", "v1.2.4", -1, PatchBump, true},
+		{"git", "abc123def456", "0fe987aa11", 0, "", false},
+		{"apk", "1.2.3-r0", "1.2.3-r1", -1, PatchBump, true},
+		{"apk", "1.2.3-r10", "1.2.3-r9", 1, PatchBump, true},
+		{"apk", "1.2.3", "1.2.3-r0", 0, "", true},
+		{"apk", "1.2", "1.2.1", -1, PatchBump, true},
+		{"apk", "1.2.3a", "1.2.3b", -1, PatchBump, true},
+		{"apk", "1.2.3_rc1", "1.2.3", -1, PatchBump, true},
+		{"apk", "1.2.3_alpha2", "1.2.3_beta1", -1, PatchBump, true},
+		{"apk", "1.2.3_p1", "1.2.3", 1, PatchBump, true},
+		{"apk", "3.1.4-r5", "3.2.0-r0", -1, MinorBump, true},
+		{"apk", "3.1.4-r5", "2.9.0-r0", 1, MajorBump, true},
+		{"apk", "2024a-r0", "2024b-r0", -1, PatchBump, true},
+		{"apk", "1.2.3_what", "1.2.3", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.a+" "+tt.b, func(t *testing.T) {
+			cmp, bump, ok := compareVersions(tt.kind, tt.a, tt.b)
+			assert.Equal(t, tt.wantCmp, cmp)
+			assert.Equal(t, tt.wantBump, bump)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}